@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/config"
+	"github.com/altsrc-io/Jest/jail"
+	"github.com/altsrc-io/Jest/model"
+	"github.com/altsrc-io/Jest/template"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type (
+	ConfigUpdate   model.ConfigUpdate
+	ConfigRollback model.ConfigRollback
+	ConfigResponse model.ConfigResponse
+)
+
+func (s *Server) GetConfigEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received a get config request from " + r.RemoteAddr)
+
+	w.WriteHeader(http.StatusOK)
+	res := ConfigResponse{"Config found.", nil, s.Conf, config.List(s.DB)}
+	log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+func (s *Server) UpdateConfigEndpoint(w http.ResponseWriter, r *http.Request) {
+	var form ConfigUpdate
+	log.Info("Received an update config request from " + r.RemoteAddr)
+
+	log.Debug("Decoding the JSON request.")
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		res := ConfigResponse{"Failed to decode the JSON request", newError(CodeInvalidRequest, err), s.Conf, nil}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"request": form, "error": err}).Warn(res.Message)
+		return
+	}
+	log.WithFields(log.Fields{"request": form}).Debug("Decoded JSON request.")
+
+	// Anything left out of the request keeps its current value.
+	conf := s.Conf
+	if form.DefaultTemplate != "" {
+		conf.DefaultTemplate = form.DefaultTemplate
+	}
+	if form.ListenAddr != "" {
+		conf.ListenAddr = form.ListenAddr
+	}
+	if form.FTPMirror != "" {
+		conf.FTPMirror = form.FTPMirror
+	}
+	conf.JailDefaults = config.MergeJailDefaults(conf.JailDefaults, form.JailDefaults)
+	if form.TLS != nil {
+		conf.TLS = *form.TLS
+	}
+
+	message, confErr := s.validateConfig(conf)
+	if confErr != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		res := ConfigResponse{message, confErr, s.Conf, nil}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	conf, err = config.Save(s.DB, conf)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := ConfigResponse{"Failed to save the config.", newError(CodeInternal, err), s.Conf, nil}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+	s.Conf = conf
+
+	w.WriteHeader(http.StatusOK)
+	res := ConfigResponse{"Config updated.", nil, s.Conf, config.List(s.DB)}
+	log.WithFields(log.Fields{"error": res.Error, "version": s.Conf.Version}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+func (s *Server) RollbackConfigEndpoint(w http.ResponseWriter, r *http.Request) {
+	var form ConfigRollback
+	log.Info("Received a rollback config request from " + r.RemoteAddr)
+
+	log.Debug("Decoding the JSON request.")
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		res := ConfigResponse{"Failed to decode the JSON request", newError(CodeInvalidRequest, err), s.Conf, nil}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"request": form, "error": err}).Warn(res.Message)
+		return
+	}
+	log.WithFields(log.Fields{"request": form}).Debug("Decoded JSON request.")
+
+	configs := config.List(s.DB)
+	for c := range configs {
+		if configs[c].Version == form.Version {
+			// The host may have changed since, e.g. the template may have been deleted.
+			message, confErr := s.validateConfig(configs[c])
+			if confErr != nil {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				res := ConfigResponse{message, confErr, s.Conf, nil}
+				json.NewEncoder(w).Encode(res)
+				log.WithFields(log.Fields{"error": res.Error, "version": form.Version}).Warn(res.Message)
+				return
+			}
+
+			// Rolling back saves the old version as the newest one, so the history stays linear.
+			conf, err := config.Save(s.DB, configs[c])
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				res := ConfigResponse{"Failed to save the config.", newError(CodeInternal, err), s.Conf, nil}
+				json.NewEncoder(w).Encode(res)
+				log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+				return
+			}
+
+			s.Conf, err = config.Load(s.DB)
+			if err != nil {
+				log.WithFields(log.Fields{"error": err}).Warn("Failed to reload the config.")
+				s.Conf = conf
+			}
+
+			w.WriteHeader(http.StatusOK)
+			res := ConfigResponse{fmt.Sprintf("Config rolled back to version %d.", form.Version), nil, s.Conf, config.List(s.DB)}
+			log.WithFields(log.Fields{"error": res.Error, "version": s.Conf.Version}).Info(res.Message)
+			json.NewEncoder(w).Encode(res)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+	res := ConfigResponse{"Config version not found.", newError(CodeNotFound, fmt.Errorf("There is no config with the version %d.", form.Version)), s.Conf, nil}
+	log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+/*
+	Check a config an update or a rollback is about to save, returning the message and
+	error to respond with if it isn't valid. The DefaultTemplate has to exist and the TLS
+	config has to load, if they differ from the current ones, and the jail defaults'
+	StopTimeout has to be a number of seconds.
+*/
+func (s *Server) validateConfig(conf config.Config) (string, *Error) {
+	if conf.DefaultTemplate != s.Conf.DefaultTemplate {
+		_, err := template.Find(conf.DefaultTemplate, template.List(s.Host))
+		if err != nil {
+			return "Invalid default template.", invalidField("DefaultTemplate", err)
+		}
+	}
+
+	err := jail.ValidateStopTimeout(conf.JailDefaults.StopTimeout)
+	if err != nil {
+		return "Invalid jail defaults.", invalidField("JailDefaults.StopTimeout", err)
+	}
+
+	if conf.TLS != s.Conf.TLS && conf.TLS.Disabled == false {
+		_, err := s.serverTLSConfig(conf.TLS)
+		if err != nil {
+			return "Invalid TLS config.", invalidField("TLS", err)
+		}
+	}
+	return "", nil
+}
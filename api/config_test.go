@@ -0,0 +1,74 @@
+package api
+
+import (
+	"github.com/altsrc-io/Jest/config"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateConfigMergesJailDefaults(t *testing.T) {
+	ts := newTestServer(t, true)
+	defer ts.Close()
+
+	var res testResponse
+	status := ts.do(t, "PUT", "/config", ConfigUpdate{JailDefaults: config.JailDefaults{JailUser: "www"}}, &res)
+	if status != http.StatusOK {
+		t.Fatalf("PUT /config = %d, %s", status, res.Message)
+	}
+
+	want := config.DefaultJailDefaults
+	want.JailUser = "www"
+	if res.Config.JailDefaults != want {
+		t.Errorf("The JailDefaults after setting the JailUser = %+v, want %+v", res.Config.JailDefaults, want)
+	}
+
+	res = testResponse{}
+	status = ts.do(t, "PUT", "/config", ConfigUpdate{JailDefaults: config.JailDefaults{StopTimeout: "soon"}}, &res)
+	if status != http.StatusUnprocessableEntity || res.Error == nil || res.Error.Details["Field"] != "JailDefaults.StopTimeout" {
+		t.Errorf("PUT /config with an invalid StopTimeout = %d, %+v, want a %s", status, res.Error, CodeValidationFailed)
+	}
+
+	res = testResponse{}
+	ts.do(t, "GET", "/config", nil, &res)
+	if res.Config.JailDefaults != want {
+		t.Errorf("The JailDefaults after an invalid update = %+v, want %+v", res.Config.JailDefaults, want)
+	}
+}
+
+func TestRollbackConfigChecksTheDefaultTemplate(t *testing.T) {
+	ts := newTestServer(t, true)
+	defer ts.Close()
+
+	ts.Storage.CreateFilesystem("zroot/jails/.web", map[string]string{"mountpoint": filepath.Join(ts.Dir, ".web")})
+	ts.Storage.Snapshot("zroot/jails/.web", "Ready")
+	err := putTestTemplate(ts.Host, "web", ts.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var res testResponse
+	if status := ts.do(t, "PUT", "/config", ConfigUpdate{DefaultTemplate: "web"}, &res); status != http.StatusOK {
+		t.Fatalf("PUT /config = %d, %s", status, res.Message)
+	}
+	webVersion := res.Config.Version
+	if status := ts.do(t, "PUT", "/config", ConfigUpdate{DefaultTemplate: "default"}, &res); status != http.StatusOK {
+		t.Fatalf("PUT /config = %d, %s", status, res.Message)
+	}
+
+	if status := ts.do(t, "DELETE", "/templates/web", nil, &res); status != http.StatusOK {
+		t.Fatalf("DELETE /templates/web = %d, %s", status, res.Message)
+	}
+
+	res = testResponse{}
+	status := ts.do(t, "POST", "/config", ConfigRollback{Version: webVersion}, &res)
+	if status != http.StatusUnprocessableEntity || res.Error == nil || res.Error.Details["Field"] != "DefaultTemplate" {
+		t.Errorf("POST /config back to the deleted DefaultTemplate = %d, %+v, want a %s", status, res.Error, CodeValidationFailed)
+	}
+
+	res = testResponse{}
+	ts.do(t, "GET", "/config", nil, &res)
+	if res.Config.DefaultTemplate != "default" {
+		t.Errorf("The DefaultTemplate after the failed rollback = %q, want default", res.Config.DefaultTemplate)
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/altsrc-io/Jest/jail"
+	"github.com/altsrc-io/Jest/model"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// The Error of every response envelope, see model.Error.
+type Error = model.Error
+
+// The error catalogue, the README lists the status each is returned with.
+const (
+	CodeInvalidRequest     = model.CodeInvalidRequest
+	CodeValidationFailed   = model.CodeValidationFailed
+	CodeNameInUse          = model.CodeNameInUse
+	CodeHostnameInUse      = model.CodeHostnameInUse
+	CodeIPInUse            = model.CodeIPInUse
+	CodeConflict           = model.CodeConflict
+	CodeAlreadyInitialised = model.CodeAlreadyInitialised
+	CodeNotInitialised     = model.CodeNotInitialised
+	CodeInitialising       = model.CodeInitialising
+	CodeNotFound           = model.CodeNotFound
+	CodeUnauthenticated    = model.CodeUnauthenticated
+	CodeForbidden          = model.CodeForbidden
+	CodeInternal           = model.CodeInternal
+)
+
+type ErrorResponse model.ErrorResponse
+
+func newError(code string, err error) *Error {
+	return &Error{Code: code, Message: err.Error()}
+}
+
+// A validation_failed error about one field of the request.
+func invalidField(field string, err error) *Error {
+	return &Error{Code: CodeValidationFailed, Message: err.Error(), Details: map[string]string{"Field": field}}
+}
+
+/*
+	The status and Error for a jail config which failed jail.Validate: a 409 if another
+	jail already has the name, hostname or IP address, otherwise a 422.
+*/
+func jailFormError(err error) (int, *Error) {
+	fieldErr, ok := err.(*jail.FieldError)
+	if ok == false {
+		return http.StatusInternalServerError, newError(CodeInternal, err)
+	}
+
+	details := map[string]string{"Field": fieldErr.Field, "Value": fieldErr.Value}
+	if fieldErr.Jail == "" {
+		return http.StatusUnprocessableEntity, &Error{Code: CodeValidationFailed, Message: fieldErr.Reason, Details: details}
+	}
+
+	details["Jail"] = fieldErr.Jail
+	code := CodeNameInUse
+	switch fieldErr.Field {
+	case "Hostname":
+		code = CodeHostnameInUse
+	case "IPV4Addr", "IPV6Addr":
+		code = CodeIPInUse
+	}
+	return http.StatusConflict, &Error{Code: code, Message: fieldErr.Reason, Details: details}
+}
+
+// Write a response with nothing but a Message and Error.
+func writeError(w http.ResponseWriter, status int, message string, err *Error) {
+	w.WriteHeader(status)
+	res := ErrorResponse{message, err}
+	log.WithFields(log.Fields{"error": res.Error, "code": err.Code}).Warn(res.Message)
+	json.NewEncoder(w).Encode(res)
+}
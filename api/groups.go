@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/host"
+	"github.com/altsrc-io/Jest/jail"
+	"github.com/altsrc-io/Jest/model"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+)
+
+type (
+	GroupsResponse      model.GroupsResponse
+	GroupActionResponse model.GroupActionResponse
+)
+
+var groupMessages = map[string]string{
+	"start":   "Group started.",
+	"stop":    "Group stopped.",
+	"restart": "Group restarted.",
+}
+
+var dependenciesMessages = map[string]string{
+	"start":   "Jail started, after the jails it depends on.",
+	"stop":    "Jail stopped, after the jails which depend on it.",
+	"restart": "Jail restarted, along with the jails which depend on it.",
+}
+
+// Start, stop or restart the jails in dependency order.
+func runJailsAction(h *host.Host, action string, names []string, opts jail.StopOptions) ([]jail.Step, error) {
+	switch action {
+	case "start":
+		return jail.StartJails(h, names)
+	case "stop":
+		return jail.StopJails(h, names, opts)
+	}
+	return jail.RestartJails(h, names, opts)
+}
+
+// A 409 if the jails depend on each other in a cycle, so they can't be ordered, otherwise a 500.
+func jailsActionError(err error) (int, *Error) {
+	if cycle, ok := err.(*jail.CycleError); ok {
+		return http.StatusConflict, newError(CodeConflict, cycle)
+	}
+	return http.StatusInternalServerError, newError(CodeInternal, err)
+}
+
+func (s *Server) ListGroupsEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received a list groups request from " + r.RemoteAddr)
+
+	w.WriteHeader(http.StatusOK)
+	res := GroupsResponse{"Groups found.", nil, jail.Groups(s.Host)}
+	log.WithFields(log.Fields{"error": res.Error}).Debug(res.Message)
+	json.NewEncoder(w).Encode(res)
+}
+
+/*
+	Start, stop or restart every jail in the group. Jails are started after the jails they
+	depend on, which are started too, and stopped after the jails which depend on them,
+	which are stopped too.
+*/
+func (s *Server) GroupActionEndpoint(w http.ResponseWriter, r *http.Request) {
+	form := JailAction{Force: true}
+	vars := mux.Vars(r)
+	group := vars["group"]
+	action := vars["action"]
+	log.WithFields(log.Fields{"group": group, "action": action}).Info("Received a group action request from " + r.RemoteAddr)
+
+	log.Debug("Decoding the JSON request.")
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil && err != io.EOF {
+		w.WriteHeader(http.StatusBadRequest)
+		res := GroupActionResponse{"Failed to decode the JSON request", newError(CodeInvalidRequest, err), group, nil}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"request": form, "error": err}).Warn(res.Message)
+		return
+	}
+	if form.StopTimeout < 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		res := GroupActionResponse{"The stop timeout isn't valid.", invalidField("StopTimeout", fmt.Errorf("The stop timeout can't be negative.")), group, nil}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"request": form, "error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	members := jail.Groups(s.Host)[group]
+	if len(members) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		res := GroupActionResponse{"Group not found.", newError(CodeNotFound, fmt.Errorf("There are no jails in the group "+group+".")), group, nil}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	opts := jail.StopOptions{Timeout: form.StopTimeout, Force: form.Force}
+	steps, err := runJailsAction(s.Host, action, members, opts)
+	if err != nil {
+		status, actionErr := jailsActionError(err)
+		w.WriteHeader(status)
+		res := GroupActionResponse{"Couldn't " + action + " the group.", actionErr, group, steps}
+		log.WithFields(log.Fields{"error": res.Error, "group": group}).Warn(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	res := GroupActionResponse{groupMessages[action], nil, group, steps}
+	log.WithFields(log.Fields{"error": res.Error, "group": group}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+}
@@ -1,10 +1,12 @@
-package main
+package api
 
 import (
 	"fmt"
 	"net/http"
 )
 
+const Version = "0.1.0"
+
 func HomeHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("Jest Version:", Version, "Documentation:")
 }
@@ -0,0 +1,448 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/config"
+	"github.com/altsrc-io/Jest/host"
+	"github.com/altsrc-io/Jest/jail"
+	"github.com/altsrc-io/Jest/job"
+	"github.com/altsrc-io/Jest/model"
+	"github.com/altsrc-io/Jest/template"
+	"github.com/altsrc-io/Jest/zfs"
+	"github.com/boltdb/bolt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"path/filepath"
+)
+
+type InitResponse struct {
+	Message  string
+	Error    *Error
+	Datasets []zfs.Dataset
+	Password string
+}
+
+type (
+	DeleteInitResponse model.DeleteInitResponse
+	InitDelete         model.InitDelete
+	InitCreate         model.InitCreate
+)
+
+func (s *Server) CreateInitEndpoint(w http.ResponseWriter, r *http.Request) {
+	var i InitCreate
+	var datasets []zfs.Dataset
+
+	log.Info("Received a initialisation request from " + r.RemoteAddr)
+
+	log.Debug("Checking if server is already initialised.")
+	if s.IsInitialised == true {
+		err := fmt.Errorf("This host is already initialised.")
+		res := InitResponse{"Cannot initialise", newError(CodeAlreadyInitialised, err), datasets, ""}
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": err}).Warn(res.Message)
+		return
+	}
+
+	if running := s.Jobs.Running(job.TypeInit); running != nil {
+		err := fmt.Errorf("The host is already being initialised by the job " + running.ID + ".")
+		res := InitResponse{"Cannot initialise", newError(CodeConflict, err), datasets, ""}
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": err}).Warn(res.Message)
+		return
+	}
+
+	log.Info("Decoding the JSON request.")
+	err := json.NewDecoder(r.Body).Decode(&i)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		res := InitResponse{"Failed to decode JSON request.", newError(CodeInvalidRequest, err), datasets, ""}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"request": i, "error": err}).Warn(res.Message)
+		return
+	}
+	log.WithFields(log.Fields{"request": i}).Info("Decoded JSON request.")
+
+	if i.ZFSParams.Name == "" {
+		i.ZFSParams.Name = s.Options.Dataset
+	}
+
+	log.WithFields(log.Fields{"version": i.FreeBSDParams.Version}).Info("Validating FreeBSD version.")
+	err = template.ValidateVersion(i.FreeBSDParams.Version)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		res := InitResponse{"Invalid FreeBSD Version specified.", invalidField("Version", err), datasets, ""}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"Error": err}).Warn(res.Message)
+		return
+	}
+
+	j := s.Jobs.New(job.TypeInit, requestToken(r).ID)
+	go s.runInitJob(j, i)
+
+	writeJobAccepted(w, j, "Initialising the host, poll the job for progress.")
+}
+
+/*
+	Initialise the host as described by the request, the result of the job is the
+	InitResponse the endpoint used to return, including the root password.
+*/
+func (s *Server) runInitJob(j *job.Job, i InitCreate) {
+	files := []string{"base.txz", "lib32.txz", "src.txz"}
+	templatePath := filepath.Join(i.ZFSParams.Mountpoint, "."+i.FreeBSDParams.Name)
+
+	j.SetStep("Creating ZFS datasets.")
+	datasets, err := s.InitDataset(i.ZFSParams, i.FreeBSDParams.Name)
+	if err != nil {
+		j.Fail("Failed to create dataset " + i.ZFSParams.Name + ".", err)
+		return
+	}
+	log.WithFields(log.Fields{"request": i, "datasets": datasets}).Info("Created ZFS datasets.")
+
+	j.SetStep("Downloading FreeBSD files.")
+	err = template.DownloadVersion(s.Host, j, i.FreeBSDParams.Version, filepath.Join(templatePath), files)
+	if err != nil {
+		j.Fail("Failed to get FreeBSD files for version " + i.FreeBSDParams.Version + ".", err)
+		return
+	}
+
+	if err := j.Cancelled(); err != nil {
+		j.Fail("Stopped before finishing.", err)
+		return
+	}
+
+	j.SetStep("Extracting FreeBSD archive files.")
+	err = host.ExtractFiles(templatePath, files)
+	if err != nil {
+		j.Fail("Failed to extract FreeBSD archive files.", err)
+		return
+	}
+
+	j.SetStep("Removing the extracted archive files.")
+	err = template.RemoveOldArchives(templatePath, files)
+	if err != nil {
+		j.Fail("Failed to cleanup the extracted FreeBSD files.", err)
+		return
+	}
+
+	if err := j.Cancelled(); err != nil {
+		j.Fail("Stopped before finishing.", err)
+		return
+	}
+
+	j.SetStep("Preparing the base jail.")
+	pw, err := template.PrepareBaseJail(s.Host, templatePath, i.FreeBSDParams.ApplyUpdates)
+	if err != nil {
+		j.Fail("Failed to prepare the base jail.", err)
+		return
+	}
+
+	// ToDo: Add error handling here if we can't find the jail
+	j.SetStep("Taking a snapshot of the base jail.")
+	for i := range datasets {
+		if datasets[i].Mountpoint == templatePath {
+			_, err := s.SnapshotZFSDataset(datasets[i])
+			if err != nil {
+				j.Fail("Failed to snapshot the base jail", err)
+				return
+			}
+		}
+	}
+
+	j.SetStep("Preparing the host to run jails.")
+	rcConfAdded, err := host.PrepareHostConfig()
+	if err != nil {
+		j.Fail("Failed while preparing the host configuration files for jails.", err)
+		return
+	}
+
+	// Requests are running alongside the job, so they're held off while the state is replaced.
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	j.SetStep("Initialising host..")
+	jestDir, isInitialised, initErr := s.InitStatus()
+	s.JestDir = jestDir
+	s.IsInitialised = isInitialised
+	if initErr != nil {
+		j.Fail("Failed while trying to find the created ZFS pool.", initErr)
+		return
+	}
+
+	j.SetStep("Starting the DB")
+	jestDB, err := s.OpenDB()
+	s.DB = jestDB
+	if err != nil {
+		s.IsInitialised = false
+		j.Fail("Failed trying to start the DB.", err)
+		return
+	}
+
+	s.publishJobsDB()
+
+	err = s.saveBootstrapToken()
+	if err != nil {
+		j.Fail("Failed to save the bootstrap token to the DB.", err)
+		return
+	}
+
+	err = s.saveSelfSignedCertificate()
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Warn("Failed to save the self-signed TLS certificate, a new one will be generated when Jest restarts.")
+	}
+
+	err = s.SaveHostConfig(rcConfAdded)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "lines": rcConfAdded}).Warn("Failed to record the lines added to /etc/rc.conf, they won't be removed when the host is de-initialised.")
+	}
+
+	log.Info("Writing template settings to the DB.")
+	err = template.Put(s.Host, template.Template{Name: i.FreeBSDParams.Name, Path: templatePath, Version: i.FreeBSDParams.Version, ZFSParams: i.ZFSParams})
+	if err != nil {
+		j.Fail("Failed to write the template to the DB.", err)
+		return
+	}
+
+	log.Info("Writing Jest config to the DB.")
+	_, err = config.Save(s.DB, config.Config{
+		JestDir:         i.ZFSParams.Mountpoint,
+		JestDataset:     i.ZFSParams.Name,
+		DefaultTemplate: i.FreeBSDParams.Name,
+		ListenAddr:      config.DefaultListenAddr,
+		FTPMirror:       config.FTPSite,
+		JailDefaults:    config.DefaultJailDefaults,
+	})
+	if err != nil {
+		j.Fail("Failed to write the config to the DB.", err)
+		return
+	}
+
+	conf, err := config.Load(s.DB)
+	if err != nil {
+		j.Fail("Failed trying to load the config from the DB.", err)
+		return
+	}
+	s.Conf = conf
+
+	// The password is only returned once, to whoever started the init, it isn't saved with the job.
+	res := InitResponse{"Successfully initialised the host for use with Jest.", nil, datasets, ""}
+	secret := res
+	secret.Password = pw
+	j.SucceedWithSecret(res, secret)
+	log.Info("Successfully finished initialising the host for use with Jest.")
+}
+
+func (s *Server) GetInitEndpoint(w http.ResponseWriter, r *http.Request) {
+	_ = r
+	var datasets []zfs.Dataset
+
+	l, err := s.Storage.Datasets()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InitResponse{"Failed to list the ZFS datasets on the system.", newError(CodeInternal, err), datasets, ""})
+		return
+	}
+
+	for d := range l {
+		jestDir, _ := s.Storage.GetProperty(l[d].Name, "jest:dir")
+		if jestDir != "" && jestDir != "-" {
+			datasets = append(datasets, *l[d])
+		}
+	}
+
+	if len(datasets) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(InitResponse{
+			"Failed to find any ZFS datasets registered with Jest.",
+			newError(CodeNotFound, fmt.Errorf("No ZFS datasets containing property jest:dir found")),
+			datasets,
+			"",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(InitResponse{"This server has been initialised for Jest.", nil, datasets, ""})
+}
+
+/*
+	Work out what has to be torn down to de-initialise the host: the running jails to stop
+	and the datasets to destroy. Clones have to go before the templates they were cloned from,
+	and the root dataset last.
+*/
+func (s *Server) planDeinit() ([]jail.Config, []string) {
+	var running []jail.Config
+	var datasets []string
+
+	jails := jail.List(s.Host)
+	for j := range jails {
+		if jails[j].JailState.Running {
+			running = append(running, jails[j].JailConfig)
+		}
+		datasets = append(datasets, jail.DatasetName(s.Host, jails[j].JailConfig.JailName))
+	}
+
+	templates := template.List(s.Host)
+	for t := range templates {
+		datasets = append(datasets, templates[t].ZFSParams.Name+"/."+templates[t].Name)
+	}
+
+	datasets = append(datasets, s.Conf.JestDataset+"/.jest", s.Conf.JestDataset)
+	return running, datasets
+}
+
+func (s *Server) DeleteInitEndpoint(w http.ResponseWriter, r *http.Request) {
+	var form InitDelete
+	log.Info("Received a de-initialisation request from " + r.RemoteAddr)
+
+	if s.IsInitialised == false {
+		err := fmt.Errorf("This host is not initialised.")
+		res := DeleteInitResponse{"Cannot de-initialise", newError(CodeNotInitialised, err), false, nil, nil}
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": err}).Warn(res.Message)
+		return
+	}
+
+	log.Debug("Decoding the JSON request.")
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil && err != io.EOF {
+		w.WriteHeader(http.StatusBadRequest)
+		res := DeleteInitResponse{"Failed to decode JSON request.", newError(CodeInvalidRequest, err), false, nil, nil}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"request": form, "error": err}).Warn(res.Message)
+		return
+	}
+
+	running, datasets := s.planDeinit()
+
+	var jails []string
+	for j := range running {
+		jails = append(jails, running[j].JailName)
+	}
+
+	if form.DryRun {
+		w.WriteHeader(http.StatusOK)
+		res := DeleteInitResponse{"Dry run - nothing was stopped or destroyed.", nil, true, jails, datasets}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"jails": jails, "datasets": datasets}).Info(res.Message)
+		return
+	}
+
+	// A template job works on its own copy of the host, so it'd be left creating a dataset in one being destroyed.
+	if creating := s.Jobs.Running(job.TypeTemplate); creating != nil {
+		err := fmt.Errorf("The template job " + creating.ID + " is still running, wait for it to finish or cancel it first.")
+		res := DeleteInitResponse{"Cannot de-initialise while a template is being created.", newError(CodeConflict, err), false, jails, datasets}
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": err, "job": creating.ID}).Warn(res.Message)
+		return
+	}
+
+	log.Info("Stopping the running jails.")
+	for j := range running {
+		_, _, err := jail.StopWithOutput(s.Host, running[j], jail.StopOptions{Force: true})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			res := DeleteInitResponse{"Failed to stop the jail " + running[j].JailName + ".", newError(CodeInternal, err), false, jails[:j], nil}
+			json.NewEncoder(w).Encode(res)
+			log.WithFields(log.Fields{"Error": err}).Warn(res.Message)
+			return
+		}
+	}
+
+	/*
+		The host stays initialised until everything else is gone, so a teardown which
+		fails part way can be retried. Destroying a dataset which is already gone does
+		nothing.
+	*/
+	jestDataset := len(datasets) - 2
+	log.Info("Destroying the jail and template datasets.")
+	for d := 0; d < jestDataset; d++ {
+		err := s.DestroyZFSDataset(datasets[d], true)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			res := DeleteInitResponse{"Failed to destroy the dataset " + datasets[d] + ".", newError(CodeInternal, err), false, jails, datasets[:d]}
+			json.NewEncoder(w).Encode(res)
+			log.WithFields(log.Fields{"Error": err}).Warn(res.Message)
+			return
+		}
+	}
+
+	log.Info("Removing the host configuration for jails.")
+	added, err := s.AddedHostConfig()
+	if err == nil {
+		err = host.RemoveHostConfig(added)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := DeleteInitResponse{"Failed while removing the host configuration for jails.", newError(CodeInternal, err), false, jails, datasets[:jestDataset]}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"Error": err}).Warn(res.Message)
+		return
+	}
+
+	// The DB lives in the .jest dataset, so it has to be closed before that is destroyed.
+	log.Info("Closing the DB.")
+	err = s.DB.Close()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := DeleteInitResponse{"Failed to close the DB.", newError(CodeInternal, err), false, jails, datasets[:jestDataset]}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"Error": err}).Warn(res.Message)
+		return
+	}
+
+	log.Info("Destroying the Jest datasets.")
+	err = s.DestroyZFSDataset(datasets[jestDataset], true)
+	if err != nil {
+		// The DB is still there, so open it again and leave the host initialised for a retry.
+		db, openErr := s.OpenDB()
+		if openErr == nil {
+			s.DB = db
+			s.publishJobsDB()
+		} else {
+			log.WithFields(log.Fields{"error": openErr}).Warn("Failed to open the DB again.")
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		res := DeleteInitResponse{"Failed to destroy the dataset " + datasets[jestDataset] + ".", newError(CodeInternal, err), false, jails, datasets[:jestDataset]}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"Error": err}).Warn(res.Message)
+		return
+	}
+
+	// The DB is gone now, so whatever happens next the host is no longer initialised.
+	rootDataset := s.Conf.JestDataset
+	s.DB = &bolt.DB{}
+	s.IsInitialised = false
+	s.JestDir = "Not set"
+	s.Conf = config.Config{}
+	s.publishJobsDB()
+
+	// The tokens were in the DB, so print a new bootstrap token to initialise the host again with.
+	err = s.setupBootstrapToken()
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Warn("Failed to create a new bootstrap token.")
+	}
+
+	log.Info("Clearing the jest:dir property.")
+	err = s.ClearZFSProperty(rootDataset, "jest:dir")
+	if err == nil {
+		err = s.DestroyZFSDataset(rootDataset, true)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := DeleteInitResponse{"Failed to remove the dataset " + rootDataset + ", destroy it with zfs destroy -r.", newError(CodeInternal, err), false, jails, datasets[:jestDataset+1]}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"Error": err}).Warn(res.Message)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(DeleteInitResponse{"Successfully de-initialised the host.", nil, false, jails, datasets})
+	log.Info("Successfully finished de-initialising the host.")
+}
@@ -0,0 +1,527 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/jail"
+	"github.com/altsrc-io/Jest/model"
+	"github.com/altsrc-io/Jest/snapshot"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type (
+	CreateJailResponse model.CreateJailResponse
+	JailsResponse      model.JailsResponse
+	JailResponse       model.JailResponse
+	JailDelete         model.JailDelete
+	JailUpdate         model.JailUpdate
+	JailUpdateResponse model.JailUpdateResponse
+	JailStateResponse  model.JailStateResponse
+	JailAction         model.JailAction
+	JailActionResponse model.JailActionResponse
+)
+
+func (s *Server) CreateJailsEndpoint(w http.ResponseWriter, r *http.Request) {
+	jUID := uuid.NewV4().String()
+
+	var form jail.Config
+	log.Info("Received a create jail request from " + r.RemoteAddr)
+
+	log.Debug("Decoding the JSON request.")
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		res := CreateJailResponse{"Failed to decode the JSON request", newError(CodeInvalidRequest, err), jUID}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"request": form, "error": err, "jUID": jUID}).Warn(res.Message)
+		return
+	}
+	log.WithFields(log.Fields{"request": form, "jUID": jUID}).Debug("Decoded JSON request.")
+
+	switch {
+	case form.JailName == "":
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		res := CreateJailResponse{"No jail name supplied.", invalidField("JailName", fmt.Errorf("You must supply a jail name to be used.")), jUID}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error, "jUID": jUID}).Warn(res.Message)
+		return
+	case form.Template == "" && s.Conf.DefaultTemplate == "":
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		res := CreateJailResponse{"No template supplied.", invalidField("Template", fmt.Errorf("You must include a template with the request, the template is the name of the base jail you wish to clone.")), jUID}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error, "jUID": jUID}).Warn(res.Message)
+		return
+	case form.Hostname == "":
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		res := CreateJailResponse{"No hostname supplied.", invalidField("Hostname", fmt.Errorf("You must include a hostname with the request.")), jUID}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error, "jUID": jUID}).Warn(res.Message)
+		return
+	case form.IPV4Addr == "" && form.IPV6Addr == "" && form.IPV4Mode == "" && form.IPV6Mode == "":
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		res := CreateJailResponse{"No IP address supplied.", invalidField("IPV4Addr", fmt.Errorf("You must include an IP, or an IPV4Mode or IPV6Mode, with the request.")), jUID}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error, "jUID": jUID}).Warn(res.Message)
+		return
+	}
+
+	err = jail.ValidateName(form.JailName)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		res := CreateJailResponse{"Invalid jail name.", invalidField("JailName", err), jUID}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error, "jUID": jUID}).Warn(res.Message)
+		return
+	}
+
+	if form.Template == "" {
+		form.Template = s.Conf.DefaultTemplate
+	}
+
+	err = jail.Validate(s.Host, form)
+	if err != nil {
+		status, formErr := jailFormError(err)
+		w.WriteHeader(status)
+		res := CreateJailResponse{"Invalid form.", formErr, jUID}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error, "jUID": jUID}).Warn(res.Message)
+		return
+	}
+
+	err = jail.Create(s.Host, jUID, form, requestToken(r).Name)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := CreateJailResponse{"Couldn't create the jail.", newError(CodeInternal, err), jUID}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error, "jUID": jUID}).Warn(res.Message)
+		return
+	}
+
+	res := CreateJailResponse{"Jail created successfully", nil, jUID}
+	log.WithFields(log.Fields{"error": res.Error, "jUID": res.JUID}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+func (s *Server) ListJailsEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received a get jails request from " + r.RemoteAddr)
+
+	jails := jail.List(s.Host)
+
+	if len(jails) < 1 {
+		w.WriteHeader(http.StatusNotFound)
+		res := JailsResponse{"No jails found.", newError(CodeNotFound, fmt.Errorf("There are no jails enabled on this host.")), jails}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	res := JailsResponse{"Jails found.", nil, jails}
+	log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+func (s *Server) GetJailEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received a get jail request from " + r.RemoteAddr)
+	vars := mux.Vars(r)
+
+	jails := jail.List(s.Host)
+
+	if len(jails) < 1 {
+		w.WriteHeader(http.StatusNotFound)
+		res := JailResponse{"No jails found.", newError(CodeNotFound, fmt.Errorf("There are no jails enabled on this host.")), jail.Jail{}}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	for j := range jails {
+		if jails[j].JailConfig.JailName == vars["name"] {
+			w.WriteHeader(http.StatusOK)
+			res := JailResponse{"Jail found.", nil, jails[j]}
+			log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+			json.NewEncoder(w).Encode(res)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+	res := JailResponse{"Jail not found.", newError(CodeNotFound, fmt.Errorf("There is no jail on this host with the name " + vars["name"])), jail.Jail{}}
+	log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+func (s *Server) ChangeJailStateEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received a change jail state request from " + r.RemoteAddr)
+	var form jail.Jail
+
+	log.Debug("Decoding the JSON request.")
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		res := JailStateResponse{"Failed to decode the JSON request", newError(CodeInvalidRequest, err), jail.State{}}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"request": form, "error": err}).Warn(res.Message)
+		return
+	}
+	log.WithFields(log.Fields{"request": form}).Debug("Decoded JSON request.")
+
+	// The jail is started or stopped with its stored config, never one from the request.
+	conf, err := jail.GetConfig(s.Host, form.JailState.Name)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		res := JailStateResponse{"Couldn't find the jail.", newError(CodeNotFound, err), jail.State{}}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	if form.JailState.Running == false {
+		stopState, err := jail.Stop(s.Host, conf)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			res := JailStateResponse{"Couldn't stop the jail.", newError(CodeInternal, err), jail.State{}}
+			log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+			json.NewEncoder(w).Encode(res)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		res := JailStateResponse{"Jail stopped.", nil, stopState}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	startState, err := jail.Start(s.Host, conf)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := JailStateResponse{"Couldn't start the jail.", newError(CodeInternal, err), jail.State{}}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	res := JailStateResponse{"Jail started.", nil, startState}
+	log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+/*
+	Start, stop or restart the jail named in the URL. Starting a running jail or stopping
+	a stopped one does nothing. What exec.start and exec.stop printed is returned in the
+	Output, including when they fail.
+*/
+func (s *Server) JailActionEndpoint(w http.ResponseWriter, r *http.Request) {
+	form := JailAction{Force: true}
+	vars := mux.Vars(r)
+	jName := vars["name"]
+	action := vars["action"]
+	log.WithFields(log.Fields{"jail": jName, "action": action}).Info("Received a jail action request from " + r.RemoteAddr)
+
+	log.Debug("Decoding the JSON request.")
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil && err != io.EOF {
+		w.WriteHeader(http.StatusBadRequest)
+		res := JailActionResponse{"Failed to decode the JSON request", newError(CodeInvalidRequest, err), jail.State{}, jail.Output{}, nil}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"request": form, "error": err}).Warn(res.Message)
+		return
+	}
+	if form.StopTimeout < 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		res := JailActionResponse{"The stop timeout isn't valid.", invalidField("StopTimeout", fmt.Errorf("The stop timeout can't be negative.")), jail.State{}, jail.Output{}, nil}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"request": form, "error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	conf, err := jail.GetConfig(s.Host, jName)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		res := JailActionResponse{"Couldn't find the jail.", newError(CodeNotFound, err), jail.State{}, jail.Output{}, nil}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	state, err := jail.Status(s.Host, conf)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := JailActionResponse{"Couldn't get the state of the jail.", newError(CodeInternal, err), state, jail.Output{}, nil}
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	var output jail.Output
+	var steps []jail.Step
+	var message string
+	opts := jail.StopOptions{Timeout: form.StopTimeout, Force: form.Force}
+
+	switch {
+	case form.Dependencies:
+		steps, err = runJailsAction(s.Host, action, []string{jName}, opts)
+		for st := range steps {
+			if steps[st].Name == jName {
+				state, output = steps[st].State, steps[st].Output
+			}
+		}
+		message = dependenciesMessages[action]
+	case action == "start" && state.Running:
+		message = "The jail is already running."
+	case action == "start":
+		state, output, err = jail.StartWithOutput(s.Host, conf)
+		message = "Jail started."
+	case action == "stop" && state.Running == false:
+		message = "The jail isn't running."
+	case action == "stop":
+		state, output, err = jail.StopWithOutput(s.Host, conf, opts)
+		message = "Jail stopped."
+	case action == "restart":
+		state, output, err = jail.Restart(s.Host, conf, opts)
+		message = "Jail restarted."
+	}
+	if output.Forced {
+		message += " exec.stop failed, so the jail was removed with jail -R."
+	}
+
+	if err != nil {
+		status, actionErr := jailsActionError(err)
+		w.WriteHeader(status)
+		res := JailActionResponse{"Couldn't " + action + " the jail.", actionErr, state, output, steps}
+		log.WithFields(log.Fields{"error": res.Error, "jail": jName, "stderr": output.Stderr}).Warn(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	res := JailActionResponse{message, nil, state, output, steps}
+	log.WithFields(log.Fields{"error": res.Error, "jail": jName, "forced": output.Forced}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+}
+
+/*
+	Update the config of a jail. A PUT replaces every field which can be updated, a PATCH
+	only the ones it sets. The new config is used the next time the jail is started, and
+	with Apply a running jail has whatever jail -m can change applied to it straight away.
+*/
+func (s *Server) UpdateJailEndpoint(w http.ResponseWriter, r *http.Request) {
+	var form JailUpdate
+	log.Info("Received an update jail request from " + r.RemoteAddr)
+	vars := mux.Vars(r)
+	jName := vars["name"]
+
+	log.Debug("Decoding the JSON request.")
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		res := JailUpdateResponse{"Failed to decode the JSON request", newError(CodeInvalidRequest, err), jail.Jail{}, nil, nil, false}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"request": form, "error": err}).Warn(res.Message)
+		return
+	}
+	log.WithFields(log.Fields{"request": form}).Debug("Decoded JSON request.")
+
+	conf, err := jail.GetConfig(s.Host, jName)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		res := JailUpdateResponse{"Jail not found.", newError(CodeNotFound, err), jail.Jail{}, nil, nil, false}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+	owner := jail.Owner(s.Host, jName)
+
+	updated := jail.Apply(form.JailConfigUpdate, conf, r.Method == http.MethodPut)
+	err = jail.ValidateUpdate(s.Host, updated)
+	if err != nil {
+		status, formErr := jailFormError(err)
+		w.WriteHeader(status)
+		res := JailUpdateResponse{"Invalid form.", formErr, jail.Jail{Name: jName, JailConfig: conf, Owner: owner}, nil, nil, false}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	_, err = jail.RenderConf(updated)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		res := JailUpdateResponse{"Invalid form.", newError(CodeValidationFailed, err), jail.Jail{Name: jName, JailConfig: conf, Owner: owner}, nil, nil, false}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	changed := jail.Changed(conf, updated)
+
+	err = jail.UpdateConfig(s.Host, jName, updated)
+	if err == nil {
+		_, err = jail.WriteConf(s.Host, updated)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := JailUpdateResponse{"Couldn't save the jail's config.", newError(CodeInternal, err), jail.Jail{Name: jName, JailConfig: conf, Owner: owner}, nil, nil, false}
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	state, err := jail.Status(s.Host, updated)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "jail": jName}).Warn("Couldn't get the state of the jail.")
+	}
+
+	var applied []string
+	if state.Running && form.Apply {
+		applied, err = jail.ApplyLive(s.Host, updated, changed)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			res := JailUpdateResponse{"Saved the config but couldn't apply it to the running jail, restart it instead.", newError(CodeInternal, err), jail.Jail{Name: jName, JailConfig: updated, JailState: state, Owner: owner}, changed, nil, true}
+			log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+			json.NewEncoder(w).Encode(res)
+			return
+		}
+		state, _ = jail.Status(s.Host, updated)
+	}
+
+	restart := state.Running && jail.RestartRequired(changed, applied)
+
+	w.WriteHeader(http.StatusOK)
+	res := JailUpdateResponse{"Jail updated.", nil, jail.Jail{Name: jName, JailConfig: updated, JailState: state, Owner: owner}, changed, applied, restart}
+	log.WithFields(log.Fields{"error": res.Error, "jail": jName, "changed": changed, "applied": applied, "restartRequired": restart}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+/*
+	Every step of deleting a jail can be repeated, and the DB record is only removed once
+	the rest has succeeded, so a delete which fails half way can simply be retried.
+*/
+func (s *Server) DeleteJailEndpoint(w http.ResponseWriter, r *http.Request) {
+	var form JailDelete
+	log.Info("Received a delete jail request from " + r.RemoteAddr)
+	vars := mux.Vars(r)
+	jName := vars["name"]
+
+	log.Debug("Decoding the JSON request.")
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil && err != io.EOF {
+		w.WriteHeader(http.StatusBadRequest)
+		res := JailResponse{"Failed to decode the JSON request", newError(CodeInvalidRequest, err), jail.Jail{}}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"request": form, "error": err}).Warn(res.Message)
+		return
+	}
+
+	conf, err := jail.GetConfig(s.Host, jName)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		res := JailResponse{"Couldn't delete jail.", newError(CodeNotFound, err), jail.Jail{}}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+	owner := jail.Owner(s.Host, jName)
+
+	var names []string
+	jails := jail.Configs(s.Host)
+	for j := range jails {
+		for _, dep := range jails[j].Depends {
+			if dep == jName {
+				names = append(names, jails[j].JailName)
+				break
+			}
+		}
+	}
+	if len(names) > 0 {
+		w.WriteHeader(http.StatusConflict)
+		res := JailResponse{"Other jails depend on the jail.", &Error{Code: CodeConflict, Message: "Remove " + jName + " from the Depends of " + strings.Join(names, ", ") + " first.", Details: map[string]string{"Field": "Depends", "Jail": names[0]}}, jail.Jail{Name: jName, JailConfig: conf, Owner: owner}}
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	state, err := jail.Status(s.Host, conf)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := JailResponse{"Couldn't get the state of the jail.", newError(CodeInternal, err), jail.Jail{Name: jName, JailConfig: conf, JailState: state, Owner: owner}}
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	if state.Running {
+		log.WithFields(log.Fields{"jail": jName}).Info("Stopping the jail before deleting it.")
+		state, _, err = jail.StopWithOutput(s.Host, conf, jail.StopOptions{Force: true})
+		if err == nil && state.Running {
+			err = fmt.Errorf("The jail " + jName + " is still running.")
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			res := JailResponse{"Couldn't stop the jail.", newError(CodeInternal, err), jail.Jail{Name: jName, JailConfig: conf, JailState: state, Owner: owner}}
+			log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+			json.NewEncoder(w).Encode(res)
+			return
+		}
+	}
+
+	err = s.DestroyZFSDataset(jail.DatasetName(s.Host, jName), form.DestroySnapshots)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := JailResponse{"Couldn't destroy the jail's dataset. If it has snapshots, set DestroySnapshots to destroy them too.", newError(CodeInternal, err), jail.Jail{Name: jName, JailConfig: conf, JailState: state, Owner: owner}}
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	err = jail.RemoveConsoleLog(conf)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := JailResponse{"Couldn't remove the jail's console log.", newError(CodeInternal, err), jail.Jail{Name: jName, JailConfig: conf, JailState: state, Owner: owner}}
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	err = jail.RemoveConf(s.Host, jName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := JailResponse{"Couldn't remove the jail's jail.conf.", newError(CodeInternal, err), jail.Jail{Name: jName, JailConfig: conf, JailState: state, Owner: owner}}
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	err = jail.DeleteRecord(s.Host, jName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := JailResponse{"Couldn't delete jail.", newError(CodeInternal, err), jail.Jail{Name: jName, JailConfig: conf, JailState: state, Owner: owner}}
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	if form.DestroySnapshots {
+		err = snapshot.Prune(s.Host)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Warn("Failed to remove the records of the destroyed snapshots.")
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	res := JailResponse{"Jail deleted.", nil, jail.Jail{}}
+	log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
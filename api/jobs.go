@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/job"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type JobResponse struct {
+	Message string
+	Error   *Error
+	Job     *job.Job
+}
+
+type JobsResponse struct {
+	Message string
+	Error   *Error
+	Jobs    []*job.Job
+}
+
+func writeJobAccepted(w http.ResponseWriter, job *job.Job, message string) {
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	res := JobResponse{message, nil, job}
+	json.NewEncoder(w).Encode(res)
+	log.WithFields(log.Fields{"job": job.ID}).Info(res.Message)
+}
+
+func (s *Server) ListJobsEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received a get jobs request from " + r.RemoteAddr)
+
+	list := s.Jobs.List()
+
+	w.WriteHeader(http.StatusOK)
+	res := JobsResponse{"Jobs found.", nil, list}
+	log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+func (s *Server) GetJobEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received a get job request from " + r.RemoteAddr)
+	vars := mux.Vars(r)
+
+	job, err := s.Jobs.Get(vars["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		res := JobResponse{"Job not found.", newError(CodeNotFound, err), nil}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	res := JobResponse{"Job found.", nil, job.Reveal(requestToken(r).ID)}
+	log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+func (s *Server) CancelJobEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received a cancel job request from " + r.RemoteAddr)
+	vars := mux.Vars(r)
+
+	job, ok := s.Jobs.Active(vars["id"])
+	if ok == false || job.Running() == false {
+		w.WriteHeader(http.StatusNotFound)
+		res := JobResponse{"Job not running.", newError(CodeNotFound, fmt.Errorf("There is no running job with the ID " + vars["id"] + ".")), nil}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	// The job stops at the next point it checks for cancellation, and records itself as cancelled.
+	job.Cancel()
+	job.Logf("Cancellation requested by %s.", r.RemoteAddr)
+
+	w.WriteHeader(http.StatusAccepted)
+	res := JobResponse{"Job cancellation requested.", nil, job}
+	log.WithFields(log.Fields{"error": res.Error, "job": job.ID}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
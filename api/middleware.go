@@ -0,0 +1,128 @@
+package api
+
+import (
+	"fmt"
+	"github.com/altsrc-io/Jest/job"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"runtime/debug"
+)
+
+// Remembers whether the handler has started its response, so a panic doesn't write a second one.
+type responseRecorder struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.wroteHeader = true
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.wroteHeader = true
+	return rr.ResponseWriter.Write(b)
+}
+
+/*
+	Give every request an ID, and turn a panic in its handler into a 500 which includes
+	the ID, so it can be found in the log along with the stack trace.
+*/
+func (s *Server) RecoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := uuid.NewV4().String()
+		w.Header().Set("X-Request-ID", id)
+		rr := &responseRecorder{ResponseWriter: w}
+
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			// The server aborts the response itself.
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			log.WithFields(log.Fields{"requestID": id, "panic": p, "path": r.URL.Path, "method": r.Method, "stack": string(debug.Stack())}).Error("Recovered from a panic while handling a request.")
+			if rr.wroteHeader {
+				return
+			}
+
+			err := &Error{Code: CodeInternal, Message: fmt.Sprintf("%v", p), Details: map[string]string{"RequestID": id}}
+			writeError(rr, http.StatusInternalServerError, "Internal error, quote the request ID when reporting it.", err)
+		}()
+
+		next.ServeHTTP(rr, r)
+	})
+}
+
+// The routes which replace the host's state, so they're run on their own, by method and path.
+var exclusiveRoutes = map[string]bool{
+	"DELETE /init": true,
+	"POST /config": true,
+	"PUT /config":  true,
+}
+
+/*
+	Hold the server's state for the whole request, so the init job and the routes which
+	change it can't change it under another request.
+*/
+func (s *Server) StateMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exclusive := false
+		if route := mux.CurrentRoute(r); route != nil {
+			path, _ := route.GetPathTemplate()
+			exclusive = exclusiveRoutes[r.Method+" "+path]
+		}
+
+		if exclusive {
+			s.state.Lock()
+			defer s.state.Unlock()
+		} else {
+			s.state.RLock()
+			defer s.state.RUnlock()
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The routes which work before the host is initialised: initialising it, and following the init job.
+var uninitialisedRoutes = map[string]bool{
+	"/init":      true,
+	"/jobs":      true,
+	"/jobs/{id}": true,
+}
+
+/*
+	Reject requests which need the host to be initialised when it isn't: a 503 while the
+	init job is running, as the request can be retried once it has finished, otherwise a 409.
+*/
+func (s *Server) InitialisedMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			path, _ := route.GetPathTemplate()
+			if uninitialisedRoutes[path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if running := s.Jobs.Running(job.TypeInit); running != nil {
+			w.Header().Set("Retry-After", "30")
+			w.Header().Set("Location", "/jobs/"+running.ID)
+			writeError(w, http.StatusServiceUnavailable, "The host is being initialised.", newError(CodeInitialising, fmt.Errorf("Wait for the init job "+running.ID+" to finish.")))
+			return
+		}
+
+		if s.IsInitialised == false {
+			writeError(w, http.StatusConflict, "The host isn't initialised.", newError(CodeNotInitialised, fmt.Errorf("You must initialise the host before you can call this function.")))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
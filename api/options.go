@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+/*
+	The options Jest is started with. They're read from the config file, then the
+	environment, then the command line flags, each overriding the one before, so a
+	later one can turn DryRun back off. Unlike the Config in the DB they're available
+	before the host is initialised, and the ListenAddr and FTPMirror set here override
+	the ones in the Config.
+*/
+type Options struct {
+	ConfigFile string `json:"-"`
+	ListenAddr string
+	LogLevel   string // panic, fatal, error, warn, info or debug
+	LogFormat  string // text or json
+	FTPMirror  string
+	Dataset    string // The ZFS dataset Jest is initialised in, rather than searching every dataset for it
+	DryRun     *bool  // nil if it isn't set, rather than false, so it doesn't override the one before
+}
+
+const DefaultConfigFile = "/usr/local/etc/jest.json"
+
+var DefaultOptions = Options{
+	ConfigFile: DefaultConfigFile,
+	LogLevel:   "info",
+	LogFormat:  "text",
+}
+
+// Set every option which is set in other.
+func (o *Options) merge(other Options) {
+	if other.ListenAddr != "" {
+		o.ListenAddr = other.ListenAddr
+	}
+	if other.LogLevel != "" {
+		o.LogLevel = other.LogLevel
+	}
+	if other.LogFormat != "" {
+		o.LogFormat = other.LogFormat
+	}
+	if other.FTPMirror != "" {
+		o.FTPMirror = other.FTPMirror
+	}
+	if other.Dataset != "" {
+		o.Dataset = other.Dataset
+	}
+	if other.DryRun != nil {
+		o.DryRun = other.DryRun
+	}
+}
+
+// Whether commands are logged rather than run, which they aren't unless DryRun is set.
+func (o Options) IsDryRun() bool {
+	return o.DryRun != nil && *o.DryRun
+}
+
+func optionsFromEnv() (Options, error) {
+	var env Options
+
+	env.ConfigFile = os.Getenv("JEST_CONFIG")
+	env.ListenAddr = os.Getenv("JEST_LISTEN_ADDR")
+	env.LogLevel = os.Getenv("JEST_LOG_LEVEL")
+	env.LogFormat = os.Getenv("JEST_LOG_FORMAT")
+	env.FTPMirror = os.Getenv("JEST_FTP_MIRROR")
+	env.Dataset = os.Getenv("JEST_DATASET")
+	if value := os.Getenv("JEST_DRY_RUN"); value != "" {
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			return env, fmt.Errorf("JEST_DRY_RUN should be true or false: %s", err)
+		}
+		env.DryRun = &dryRun
+	}
+
+	return env, nil
+}
+
+// Read the config file. It's only an error for it to be missing if it was asked for.
+func optionsFromFile(path string, required bool) (Options, error) {
+	var file Options
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && required == false {
+			return file, nil
+		}
+		return file, err
+	}
+
+	err = json.Unmarshal(content, &file)
+	if err != nil {
+		return file, fmt.Errorf("Failed to decode the config file %s: %s", path, err)
+	}
+	return file, nil
+}
+
+func ParseOptions(args []string) (Options, error) {
+	var flags Options
+	var dryRun bool
+	opts := DefaultOptions
+
+	fs := flag.NewFlagSet("jest", flag.ContinueOnError)
+	fs.StringVar(&flags.ConfigFile, "config", "", "The JSON config file to read the options from (default "+DefaultConfigFile+", $JEST_CONFIG).")
+	fs.StringVar(&flags.ListenAddr, "listen", "", "The address the API listens on, overriding the one in the Jest config ($JEST_LISTEN_ADDR).")
+	fs.StringVar(&flags.LogLevel, "log-level", "", "One of panic, fatal, error, warn, info or debug (default info, $JEST_LOG_LEVEL).")
+	fs.StringVar(&flags.LogFormat, "log-format", "", "text or json (default text, $JEST_LOG_FORMAT).")
+	fs.StringVar(&flags.FTPMirror, "ftp-mirror", "", "The FreeBSD FTP mirror to download templates from, overriding the one in the Jest config ($JEST_FTP_MIRROR).")
+	fs.StringVar(&flags.Dataset, "dataset", "", "The ZFS dataset Jest is, or will be, initialised in ($JEST_DATASET).")
+	fs.BoolVar(&dryRun, "dry-run", false, "Log the commands Jest would run on the host instead of running them ($JEST_DRY_RUN).")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return opts, err
+	}
+
+	// Only a -dry-run which is given overrides the others, so -dry-run=false can turn it off.
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "dry-run" {
+			flags.DryRun = &dryRun
+		}
+	})
+
+	env, err := optionsFromEnv()
+	if err != nil {
+		return opts, err
+	}
+
+	required := true
+	switch {
+	case flags.ConfigFile != "":
+		opts.ConfigFile = flags.ConfigFile
+	case env.ConfigFile != "":
+		opts.ConfigFile = env.ConfigFile
+	default:
+		required = false
+	}
+
+	file, err := optionsFromFile(opts.ConfigFile, required)
+	if err != nil {
+		return opts, err
+	}
+
+	opts.merge(file)
+	opts.merge(env)
+	opts.merge(flags)
+
+	_, err = log.ParseLevel(opts.LogLevel)
+	if err != nil {
+		return opts, err
+	}
+	if opts.LogFormat != "text" && opts.LogFormat != "json" {
+		return opts, fmt.Errorf("The log format " + opts.LogFormat + " is not valid, it should be text or json.")
+	}
+
+	return opts, nil
+}
+
+func ConfigureLogging(opts Options) {
+	log.SetOutput(os.Stdout)
+
+	level, _ := log.ParseLevel(opts.LogLevel)
+	log.SetLevel(level)
+
+	if opts.LogFormat == "json" {
+		log.SetFormatter(&log.JSONFormatter{})
+	} else {
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseOptionsDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jest-options")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "jest.json")
+	err = ioutil.WriteFile(configFile, []byte(`{"DryRun": true}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("JEST_DRY_RUN")
+
+	cases := []struct {
+		name string
+		env  string
+		args []string
+		want bool
+	}{
+		{"unset", "", nil, false},
+		{"config file", "", []string{"-config", configFile}, true},
+		{"environment turns the config file off", "false", []string{"-config", configFile}, false},
+		{"flag turns the environment off", "true", []string{"-config", configFile, "-dry-run=false"}, false},
+		{"flag", "", []string{"-dry-run"}, true},
+	}
+
+	for _, c := range cases {
+		os.Setenv("JEST_DRY_RUN", c.env)
+
+		opts, err := ParseOptions(c.args)
+		if err != nil {
+			t.Errorf("%s: ParseOptions(%q) = %s", c.name, c.args, err)
+			continue
+		}
+		if opts.IsDryRun() != c.want {
+			t.Errorf("%s: IsDryRun() = %t, want %t", c.name, opts.IsDryRun(), c.want)
+		}
+	}
+}
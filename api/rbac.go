@@ -0,0 +1,253 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/jail"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+/*
+	Every token has a role:
+		admin     - can do anything, and is the only role which can call /init, manage
+		            templates, tokens, jobs and the config
+		operator  - can start and stop any jail
+		developer - can create jails, and manage, start, stop and snapshot the jails they own
+	Every role can read everything. A jail is owned by the Name of the token which created it,
+	so all of a person's tokens should share the same Name.
+*/
+const (
+	RoleAdmin     = "admin"
+	RoleOperator  = "operator"
+	RoleDeveloper = "developer"
+)
+
+func validateRole(role string) error {
+	switch role {
+	case RoleAdmin, RoleOperator, RoleDeveloper:
+		return nil
+	}
+	return fmt.Errorf("The role " + role + " is not valid. It should be one of " + strings.Join([]string{RoleAdmin, RoleOperator, RoleDeveloper}, ", ") + ".")
+}
+
+// Decides whether the token may make the request, returning why not if it can't.
+type permission func(r *http.Request, token Token) error
+
+/*
+	Wrap a route's handler so it's only called if the token the request was
+	authenticated with has permission, otherwise it gets a 403.
+*/
+func Authorise(p permission, h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := requestToken(r)
+
+		err := p(r, token)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			res := AuthResponse{"Permission denied.", newError(CodeForbidden, err)}
+			log.WithFields(log.Fields{"error": res.Error, "token": token.ID, "role": token.Role, "path": r.URL.Path}).Warn(res.Message)
+			json.NewEncoder(w).Encode(res)
+			return
+		}
+
+		h(w, r)
+	})
+}
+
+func anyRole(r *http.Request, token Token) error {
+	return nil
+}
+
+func adminOnly(r *http.Request, token Token) error {
+	if token.Role == RoleAdmin {
+		return nil
+	}
+	return fmt.Errorf("Only admins can " + r.Method + " " + r.URL.Path + ".")
+}
+
+func (s *Server) canCreateJail(r *http.Request, token Token) error {
+	if token.Role == RoleAdmin {
+		return nil
+	}
+	if token.Role != RoleDeveloper {
+		return fmt.Errorf("Only admins and developers can create jails.")
+	}
+
+	var form jail.Config
+	peekJSON(r, &form)
+	err := hostFields(map[string]bool{"ConsoleLog": form.ConsoleLog != "", "SystemUser": form.SystemUser != ""})
+	if err != nil {
+		return err
+	}
+	return s.ownsDepends(token, form.Depends, nil)
+}
+
+/*
+	The fields of a jail which act on the host rather than inside the jail: jail(8) writes
+	the ConsoleLog and runs the host's exec commands as the SystemUser, both as root, so
+	only admins can set them.
+*/
+func hostFields(set map[string]bool) error {
+	var fields []string
+	for _, field := range []string{"ConsoleLog", "SystemUser"} {
+		if set[field] {
+			fields = append(fields, field)
+		}
+	}
+
+	if len(fields) > 0 {
+		return fmt.Errorf("Only admins can set or change " + strings.Join(fields, " or ") + ", as they act on the host rather than in the jail.")
+	}
+	return nil
+}
+
+// The jail named in the URL, for the /jails/{name} routes.
+func (s *Server) canManageJail(r *http.Request, token Token) error {
+	return s.ownsJail(token, mux.Vars(r)["name"])
+}
+
+// Owners can update their jail, but only admins can change the fields which act on the host.
+func (s *Server) canUpdateJail(r *http.Request, token Token) error {
+	jName := mux.Vars(r)["name"]
+	err := s.ownsJail(token, jName)
+	if err != nil || token.Role == RoleAdmin {
+		return err
+	}
+
+	conf, err := jail.GetConfig(s.Host, jName)
+	if err != nil {
+		return nil // The handler returns the 404
+	}
+
+	// A PUT clears the fields it leaves out, which changes them too.
+	var form JailUpdate
+	peekJSON(r, &form)
+	updated := jail.Apply(form.JailConfigUpdate, conf, r.Method == http.MethodPut)
+	err = hostFields(map[string]bool{"ConsoleLog": updated.ConsoleLog != conf.ConsoleLog, "SystemUser": updated.SystemUser != conf.SystemUser})
+	if err != nil {
+		return err
+	}
+	return s.ownsDepends(token, updated.Depends, conf.Depends)
+}
+
+/*
+	A jail which others depend on can't be deleted, so developers can only add the jails
+	they own to a jail's Depends, rather than keep other people's jails from being deleted.
+	The dependencies it already had are left alone.
+*/
+func (s *Server) ownsDepends(token Token, depends []string, had []string) error {
+	existing := make(map[string]bool)
+	for _, dep := range had {
+		existing[dep] = true
+	}
+
+	for _, dep := range depends {
+		if existing[dep] {
+			continue
+		}
+		if err := s.ownsJail(token, dep); err != nil {
+			return fmt.Errorf("Only admins can make a jail depend on one they don't own. " + err.Error())
+		}
+	}
+	return nil
+}
+
+/*
+	Operators can start and stop any jail, developers the ones they own. With Dependencies
+	that's every jail which would be started or stopped along with it.
+*/
+func (s *Server) canStartStopJail(r *http.Request, token Token) error {
+	if token.Role == RoleOperator {
+		return nil
+	}
+
+	vars := mux.Vars(r)
+	var form JailAction
+	peekJSON(r, &form)
+	if form.Dependencies == false {
+		return s.ownsJail(token, vars["name"])
+	}
+	return s.ownsJails(token, jail.Affected(jail.Configs(s.Host), []string{vars["name"]}, vars["action"]))
+}
+
+/*
+	Developers can only start and stop a group if they own every jail in it, and every
+	jail outside it which would be started or stopped along with it.
+*/
+func (s *Server) canStartStopGroup(r *http.Request, token Token) error {
+	if token.Role == RoleOperator {
+		return nil
+	}
+
+	vars := mux.Vars(r)
+	jails := jail.Configs(s.Host)
+	members := jail.Groups(s.Host)[vars["group"]]
+	return s.ownsJails(token, jail.Affected(jails, members, vars["action"]))
+}
+
+func (s *Server) ownsJails(token Token, jails []jail.Config) error {
+	for j := range jails {
+		err := s.ownsJail(token, jails[j].JailName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The jail is named in the body of PUT /jails.
+func (s *Server) canChangeJailState(r *http.Request, token Token) error {
+	if token.Role == RoleAdmin || token.Role == RoleOperator {
+		return nil
+	}
+
+	var form jail.Jail
+	peekJSON(r, &form)
+	return s.ownsJail(token, form.JailState.Name)
+}
+
+// Jail snapshots follow the jail's owner, template snapshots are for admins.
+func (s *Server) canManageSnapshot(r *http.Request, token Token) error {
+	var form SnapshotCreate
+	form.Name = mux.Vars(r)["name"]
+	if form.Name == "" {
+		peekJSON(r, &form)
+	}
+
+	target := strings.SplitN(form.Name, "@", 2)[0]
+	if strings.HasPrefix(target, ".") {
+		return adminOnly(r, token)
+	}
+	return s.ownsJail(token, target)
+}
+
+func (s *Server) ownsJail(token Token, name string) error {
+	if token.Role == RoleAdmin {
+		return nil
+	}
+
+	if token.Role == RoleDeveloper {
+		owner := jail.Owner(s.Host, name)
+		if owner != "" && owner == token.Name {
+			return nil
+		}
+		return fmt.Errorf("The jail " + name + " isn't owned by " + token.Name + ".")
+	}
+
+	return fmt.Errorf("The " + token.Role + " role can't manage jails.")
+}
+
+// Decode the JSON body into v, leaving the body in place for the handler.
+func peekJSON(r *http.Request, v interface{}) error {
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"github.com/altsrc-io/Jest/jail"
+	"github.com/altsrc-io/Jest/template"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+// The same server, sending requests with a new token of the role.
+func (ts *testServer) as(t *testing.T, name string, role string) *testServer {
+	var res testResponse
+	status := ts.do(t, "POST", "/tokens", TokenCreate{Name: name, Role: role}, &res)
+	if status != http.StatusCreated || res.Secret == "" {
+		t.Fatalf("POST /tokens %s = %d, %s", name, status, res.Message)
+	}
+
+	other := *ts
+	other.Secret = res.Secret
+	return &other
+}
+
+func TestDevelopersCantSetHostFields(t *testing.T) {
+	ts := newTestServer(t, true)
+	defer ts.Close()
+	dev := ts.as(t, "alice", RoleDeveloper)
+
+	forms := map[string]jail.Config{
+		"ConsoleLog": {JailName: "mash", Hostname: "mash.local", IPV4Addr: "10.0.2.12", ConsoleLog: "/etc/master.passwd"},
+		"SystemUser": {JailName: "mash", Hostname: "mash.local", IPV4Addr: "10.0.2.12", SystemUser: "toor"},
+	}
+	for field, form := range forms {
+		var res testResponse
+		status := dev.do(t, "POST", "/jails", form, &res)
+		if status != http.StatusForbidden {
+			t.Errorf("POST /jails with a %s as a developer = %d, %s, want %d", field, status, res.Message, http.StatusForbidden)
+		}
+	}
+
+	// The Path is always the clone's, whoever asks.
+	dev.createJail(t, jail.Config{JailName: "mash", Hostname: "mash.local", IPV4Addr: "10.0.2.12", Path: "/"})
+	ts.createJail(t, jail.Config{JailName: "pie", Hostname: "pie.local", IPV4Addr: "10.0.2.13", Path: "/", ConsoleLog: "/var/log/jail_pie_console.log"})
+
+	for _, name := range []string{"mash", "pie"} {
+		var got testResponse
+		ts.do(t, "GET", "/jails/"+name, nil, &got)
+		if want := filepath.Join(ts.Dir, name); got.Jails.JailConfig.Path != want {
+			t.Errorf("The Path of %s = %q, want its dataset's mountpoint %q", name, got.Jails.JailConfig.Path, want)
+		}
+	}
+}
+
+func TestChangeJailStateChecksTheNamedJail(t *testing.T) {
+	ts := newTestServer(t, true)
+	defer ts.Close()
+	dev := ts.as(t, "alice", RoleDeveloper)
+
+	dev.createJail(t, jail.Config{JailName: "mash", Hostname: "mash.local", IPV4Addr: "10.0.2.12", UseDefaults: true})
+	ts.createJail(t, jail.Config{JailName: "pie", Hostname: "pie.local", IPV4Addr: "10.0.2.13", UseDefaults: true})
+
+	// Naming their own jail in the JailConfig doesn't let a developer stop another's.
+	var res testResponse
+	status := dev.do(t, "PUT", "/jails", jail.Jail{JailConfig: jail.Config{JailName: "mash"}, JailState: jail.State{Name: "pie"}}, &res)
+	if status != http.StatusForbidden {
+		t.Errorf("PUT /jails for a jail the developer doesn't own = %d, want %d", status, http.StatusForbidden)
+	}
+
+	status = dev.do(t, "PUT", "/jails", jail.Jail{JailState: jail.State{Name: "mash"}}, &res)
+	if status != http.StatusOK {
+		t.Errorf("PUT /jails for the developer's own jail = %d, %s", status, res.Message)
+	}
+}
+
+func TestDevelopersCantUpdateHostFields(t *testing.T) {
+	ts := newTestServer(t, true)
+	defer ts.Close()
+	dev := ts.as(t, "alice", RoleDeveloper)
+	dev.createJail(t, jail.Config{JailName: "mash", Hostname: "mash.local", IPV4Addr: "10.0.2.12", UseDefaults: true})
+
+	forbidden := []struct {
+		method string
+		body   map[string]interface{}
+	}{
+		{"PATCH", map[string]interface{}{"ConsoleLog": "/etc/master.passwd"}},
+		{"PATCH", map[string]interface{}{"SystemUser": "toor", "Hostname": "mash.example.org"}},
+		{"PUT", map[string]interface{}{"Hostname": "mash.example.org", "IPV4Addr": "10.0.2.12"}}, // Clears both
+	}
+	for _, test := range forbidden {
+		var res JailUpdateResponse
+		status := dev.do(t, test.method, "/jails/mash", test.body, &res)
+		if status != http.StatusForbidden || res.Error == nil || res.Error.Code != CodeForbidden {
+			t.Errorf("%s /jails/mash %v as a developer = %d, %+v, want %s", test.method, test.body, status, res.Error, CodeForbidden)
+		}
+	}
+
+	var got JailResponse
+	ts.do(t, "GET", "/jails/mash", nil, &got)
+	if got.Jails.JailConfig.ConsoleLog != "/var/log/jail_mash_console.log" || got.Jails.JailConfig.SystemUser != "root" {
+		t.Errorf("The forbidden updates changed the jail: %+v", got.Jails.JailConfig)
+	}
+
+	// Leaving them as they are is fine, and admins can change them.
+	allowed := []struct {
+		ts   *testServer
+		body map[string]interface{}
+	}{
+		{dev, map[string]interface{}{"Hostname": "mash.example.org", "ConsoleLog": "/var/log/jail_mash_console.log"}},
+		{ts, map[string]interface{}{"ConsoleLog": "/var/log/mash.log", "SystemUser": "toor"}},
+	}
+	for _, test := range allowed {
+		var res JailUpdateResponse
+		status := test.ts.do(t, "PATCH", "/jails/mash", test.body, &res)
+		if status != http.StatusOK || res.Error != nil {
+			t.Errorf("PATCH /jails/mash %v = %d, %+v", test.body, status, res.Error)
+		}
+	}
+}
+
+func TestOnlyAdminsSeeJobs(t *testing.T) {
+	ts := newTestServer(t, true)
+	defer ts.Close()
+
+	var accepted testResponse
+	ts.do(t, "POST", "/templates/web", template.FreeBSDParams{Version: "11.1-RELEASE"}, &accepted)
+	if accepted.Job == nil {
+		t.Fatalf("POST /templates/web = %+v, want a template job", accepted)
+	}
+	ts.waitForJob(t, accepted.Job.ID)
+
+	for _, role := range []string{RoleOperator, RoleDeveloper} {
+		other := ts.as(t, role, role)
+		for _, p := range []string{"/jobs", "/jobs/" + accepted.Job.ID} {
+			if status := other.do(t, "GET", p, nil, nil); status != http.StatusForbidden {
+				t.Errorf("GET %s with a %s token = %d, want %d", p, role, status, http.StatusForbidden)
+			}
+		}
+	}
+}
+
+func TestDependenciesNeedOwningEveryJail(t *testing.T) {
+	ts := newTestServer(t, true)
+	defer ts.Close()
+	dev := ts.as(t, "alice", RoleDeveloper)
+
+	dev.createJail(t, jail.Config{JailName: "db", Hostname: "db.local", IPV4Addr: "10.0.2.12", UseDefaults: true})
+	dev.createJail(t, jail.Config{JailName: "app", Hostname: "app.local", IPV4Addr: "10.0.2.13", UseDefaults: true, Groups: []string{"alice"}})
+	ts.createJail(t, jail.Config{JailName: "web", Hostname: "web.local", IPV4Addr: "10.0.2.14", UseDefaults: true, Depends: []string{"db"}})
+	ts.createJail(t, jail.Config{JailName: "cache", Hostname: "cache.local", IPV4Addr: "10.0.2.15", UseDefaults: true})
+
+	// An admin makes alice's app depend on the cache, which isn't hers.
+	var updated JailUpdateResponse
+	if status := ts.do(t, "PATCH", "/jails/app", map[string]interface{}{"Depends": []string{"cache"}}, &updated); status != http.StatusOK {
+		t.Fatalf("PATCH /jails/app as an admin = %d, %+v", status, updated.Error)
+	}
+
+	forbidden := []struct {
+		path string
+		form JailAction
+	}{
+		{"/jails/db/stop", JailAction{Dependencies: true}},    // Stops web first
+		{"/jails/db/restart", JailAction{Dependencies: true}}, // Stops and starts web
+		{"/jails/app/start", JailAction{Dependencies: true}},  // Starts the cache first
+		{"/groups/alice/start", JailAction{}},                 // The same, for the group app is in
+	}
+	for _, test := range forbidden {
+		var res JailActionResponse
+		status := dev.do(t, "POST", test.path, test.form, &res)
+		if status != http.StatusForbidden || res.Error == nil || res.Error.Code != CodeForbidden {
+			t.Errorf("POST %s %+v as alice = %d, %+v, want %s", test.path, test.form, status, res.Error, CodeForbidden)
+		}
+	}
+
+	var res JailActionResponse
+	if status := dev.do(t, "POST", "/jails/db/stop", JailAction{}, &res); status == http.StatusForbidden {
+		t.Errorf("POST /jails/db/stop without Dependencies as alice = %d, %+v, want it allowed", status, res.Error)
+	}
+	if status := ts.as(t, "bob", RoleOperator).do(t, "POST", "/jails/db/stop", JailAction{Dependencies: true}, &res); status == http.StatusForbidden {
+		t.Errorf("POST /jails/db/stop with Dependencies as an operator = %d, %+v, want it allowed", status, res.Error)
+	}
+}
+
+func TestDevelopersCanOnlyDependOnTheirJails(t *testing.T) {
+	ts := newTestServer(t, true)
+	defer ts.Close()
+	dev := ts.as(t, "alice", RoleDeveloper)
+
+	ts.createJail(t, jail.Config{JailName: "db", Hostname: "db.local", IPV4Addr: "10.0.2.12", UseDefaults: true})
+	dev.createJail(t, jail.Config{JailName: "cache", Hostname: "cache.local", IPV4Addr: "10.0.2.13", UseDefaults: true})
+
+	var created CreateJailResponse
+	status := dev.do(t, "POST", "/jails", jail.Config{JailName: "app", Hostname: "app.local", IPV4Addr: "10.0.2.14", UseDefaults: true, Depends: []string{"cache", "db"}}, &created)
+	if status != http.StatusForbidden {
+		t.Errorf("POST /jails depending on another's jail as alice = %d, %+v, want %d", status, created.Error, http.StatusForbidden)
+	}
+	dev.createJail(t, jail.Config{JailName: "app", Hostname: "app.local", IPV4Addr: "10.0.2.14", UseDefaults: true, Depends: []string{"cache"}})
+
+	var res JailUpdateResponse
+	status = dev.do(t, "PATCH", "/jails/app", map[string]interface{}{"Depends": []string{"cache", "db"}}, &res)
+	if status != http.StatusForbidden {
+		t.Errorf("PATCH /jails/app adding another's jail to Depends as alice = %d, %+v, want %d", status, res.Error, http.StatusForbidden)
+	}
+
+	// A dependency an admin added stays when alice changes something else.
+	if status := ts.do(t, "PATCH", "/jails/app", map[string]interface{}{"Depends": []string{"cache", "db"}}, &res); status != http.StatusOK {
+		t.Fatalf("PATCH /jails/app as an admin = %d, %+v", status, res.Error)
+	}
+	if status := dev.do(t, "PATCH", "/jails/app", map[string]interface{}{"Hostname": "app.example.org"}, &res); status != http.StatusOK {
+		t.Errorf("PATCH /jails/app keeping the admin's Depends as alice = %d, %+v", status, res.Error)
+	}
+
+	// The db can still be deleted by its owner once nothing depends on it.
+	if status := ts.do(t, "PATCH", "/jails/app", map[string]interface{}{"Depends": []string{"cache"}}, &res); status != http.StatusOK {
+		t.Fatalf("PATCH /jails/app as an admin = %d, %+v", status, res.Error)
+	}
+	var deleted JailResponse
+	if status := ts.do(t, "DELETE", "/jails/db", nil, &deleted); status != http.StatusOK {
+		t.Errorf("DELETE /jails/db = %d, %+v", status, deleted.Error)
+	}
+}
+
+func TestLastAdminTokenCantBeDeleted(t *testing.T) {
+	ts := newTestServer(t, true)
+	defer ts.Close()
+	ts.as(t, "alice", RoleDeveloper)
+
+	var tokens testResponse
+	ts.do(t, "GET", "/tokens", nil, &tokens)
+	bootstrap := ""
+	for _, token := range tokens.Tokens {
+		if token.Role == RoleAdmin {
+			bootstrap = token.ID
+		}
+	}
+
+	var res testResponse
+	status := ts.do(t, "DELETE", "/tokens/"+bootstrap, nil, &res)
+	if status != http.StatusConflict || res.Error == nil || res.Error.Code != CodeConflict {
+		t.Errorf("DELETE /tokens/%s, the last admin token = %d, %+v, want %s", bootstrap, status, res.Error, CodeConflict)
+	}
+
+	admin := ts.as(t, "bob", RoleAdmin)
+	if status := admin.do(t, "DELETE", "/tokens/"+bootstrap, nil, &res); status != http.StatusOK {
+		t.Errorf("DELETE /tokens/%s with another admin = %d, %s", bootstrap, status, res.Message)
+	}
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"github.com/altsrc-io/Jest/command"
+	"github.com/altsrc-io/Jest/config"
+	"github.com/altsrc-io/Jest/host"
+	"github.com/altsrc-io/Jest/job"
+	"github.com/altsrc-io/Jest/zfs"
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+	A Jest API server. It owns everything the API needs, so nothing is looked up when
+	the package is loaded and more than one can run in the same process, e.g. each
+	against its own MemoryStorage in a test.
+*/
+type Server struct {
+	*host.Host
+	Options Options
+	Out     io.Writer // Where the bootstrap token's secret is printed
+
+	Jobs *job.Manager
+
+	router *mux.Router
+
+	/*
+		Guards the Host's JestDir, IsInitialised, DB and Conf, which init, de-init and
+		config changes replace. Every request holds it for reading, or for writing if it
+		changes them, and the init job holds it while it publishes them.
+	*/
+	state sync.RWMutex
+
+	// The DB the jobs are saved in, set along with the DB, as jobs are saved outside of requests.
+	jobsDB atomic.Value
+
+	// The bootstrap token, until init creates the DB to save it in.
+	bootstrapToken struct {
+		sync.Mutex
+		pending *Token
+	}
+
+	// The self-signed TLS certificate, until init creates JestDir to save it in.
+	selfSigned struct {
+		sync.Mutex
+		cert []byte
+		key  []byte
+	}
+}
+
+/*
+	Create a server, finding out whether the host has been initialised and opening the
+	DB if it has. A host which hasn't been initialised isn't an error, the server can
+	be used to initialise it.
+*/
+func NewServer(opts Options, storage zfs.Storage, runner command.Runner, out io.Writer) (*Server, error) {
+	s := &Server{
+		Host:    host.New(storage, runner),
+		Options: opts,
+		Out:     out,
+	}
+	s.Dataset = opts.Dataset
+	s.FTPMirror = opts.FTPMirror
+
+	err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	// An init job can only be saved once it has created the DB.
+	s.publishJobsDB()
+	s.Jobs = job.NewManager(func() *bolt.DB {
+		db, _ := s.jobsDB.Load().(*bolt.DB)
+		return db
+	})
+	if s.IsInitialised == true {
+		s.Jobs.Recover()
+	}
+
+	err = s.setupBootstrapToken()
+	if err != nil {
+		return nil, err
+	}
+
+	s.router = s.routes()
+	return s, nil
+}
+
+// Save the jobs in the DB, or nowhere while the host isn't initialised. Call it with the state locked.
+func (s *Server) publishJobsDB() {
+	var db *bolt.DB
+	if s.IsInitialised {
+		db = s.DB
+	}
+	s.jobsDB.Store(db)
+}
+
+// The API's routes, with every request holding the state.
+func (s *Server) routes() *mux.Router {
+	r := mux.NewRouter()
+	r.Use(s.RecoveryMiddleware, s.StateMiddleware, s.AuthMiddleware, s.InitialisedMiddleware)
+
+	r.Handle("/tokens", Authorise(adminOnly, s.ListTokensEndpoint)).Methods("GET")
+	r.Handle("/tokens", Authorise(adminOnly, s.CreateTokenEndpoint)).Methods("POST")
+	r.Handle("/tokens/{id}", Authorise(adminOnly, s.DeleteTokenEndpoint)).Methods("DELETE")
+
+	r.Handle("/init", Authorise(adminOnly, s.GetInitEndpoint)).Methods("GET")
+	r.Handle("/init", Authorise(adminOnly, s.CreateInitEndpoint)).Methods("POST")
+	r.Handle("/init", Authorise(adminOnly, s.DeleteInitEndpoint)).Methods("DELETE")
+
+	r.Handle("/jobs", Authorise(adminOnly, s.ListJobsEndpoint)).Methods("GET")
+	r.Handle("/jobs/{id}", Authorise(adminOnly, s.GetJobEndpoint)).Methods("GET")
+	r.Handle("/jobs/{id}", Authorise(adminOnly, s.CancelJobEndpoint)).Methods("DELETE")
+
+	r.Handle("/templates", Authorise(anyRole, s.ListTemplatesEndpoint)).Methods("GET")
+	r.Handle("/templates", Authorise(adminOnly, s.CreateTemplateEndpoint)).Methods("POST")
+	r.Handle("/templates/{name}", Authorise(anyRole, s.GetTemplateEndpoint)).Methods("GET")
+	r.Handle("/templates/{name}", Authorise(adminOnly, s.CreateTemplateEndpoint)).Methods("POST")
+	r.Handle("/templates/{name}", Authorise(adminOnly, s.UpdateTemplateEndpoint)).Methods("PUT")
+	r.Handle("/templates/{name}", Authorise(adminOnly, s.DeleteTemplateEndpoint)).Methods("DELETE")
+
+	r.Handle("/jails", Authorise(anyRole, s.ListJailsEndpoint)).Methods("GET")
+	r.Handle("/jails", Authorise(s.canCreateJail, s.CreateJailsEndpoint)).Methods("POST")
+	r.Handle("/jails", Authorise(s.canChangeJailState, s.ChangeJailStateEndpoint)).Methods("PUT")
+	r.Handle("/jails/{name}", Authorise(anyRole, s.GetJailEndpoint)).Methods("GET")
+	r.Handle("/jails/{name}", Authorise(s.canCreateJail, s.CreateJailsEndpoint)).Methods("POST")
+	r.Handle("/jails/{name}", Authorise(s.canUpdateJail, s.UpdateJailEndpoint)).Methods("PUT", "PATCH")
+	r.Handle("/jails/{name}", Authorise(s.canManageJail, s.DeleteJailEndpoint)).Methods("DELETE")
+	r.Handle("/jails/{name}/{action:start|stop|restart}", Authorise(s.canStartStopJail, s.JailActionEndpoint)).Methods("POST")
+
+	r.Handle("/groups", Authorise(anyRole, s.ListGroupsEndpoint)).Methods("GET")
+	r.Handle("/groups/{group}/{action:start|stop|restart}", Authorise(s.canStartStopGroup, s.GroupActionEndpoint)).Methods("POST")
+
+	r.Handle("/snapshots", Authorise(anyRole, s.ListSnapshotsEndpoint)).Methods("GET")
+	r.Handle("/snapshots", Authorise(s.canManageSnapshot, s.CreateSnapshotEndpoint)).Methods("POST")
+	r.Handle("/snapshots/{name}", Authorise(anyRole, s.GetSnapshotEndpoint)).Methods("GET")
+	r.Handle("/snapshots/{name}", Authorise(s.canManageSnapshot, s.CreateSnapshotEndpoint)).Methods("POST")
+	r.Handle("/snapshots/{name}", Authorise(s.canManageSnapshot, s.RollbackSnapshotEndpoint)).Methods("PUT")
+	r.Handle("/snapshots/{name}", Authorise(s.canManageSnapshot, s.DeleteSnapshotEndpoint)).Methods("DELETE")
+
+	r.Handle("/config", Authorise(anyRole, s.GetConfigEndpoint)).Methods("GET")
+	r.Handle("/config", Authorise(adminOnly, s.RollbackConfigEndpoint)).Methods("POST")
+	r.Handle("/config", Authorise(adminOnly, s.UpdateConfigEndpoint)).Methods("PUT")
+
+	return r
+}
+
+// The API, e.g. for httptest.NewServer.
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
+
+// The address the API listens on: the options override the config.
+func (s *Server) ListenAddr() string {
+	if s.Options.ListenAddr != "" {
+		return s.Options.ListenAddr
+	}
+	if s.Conf.ListenAddr != "" {
+		return s.Conf.ListenAddr
+	}
+	return config.DefaultListenAddr
+}
+
+// Serve the API on ListenAddr, over TLS unless the config disables it.
+func (s *Server) ListenAndServe() error {
+	server := &http.Server{Addr: s.ListenAddr(), Handler: s.router}
+
+	if s.Conf.TLS.Disabled {
+		log.WithFields(log.Fields{"address": server.Addr}).Warn("TLS is disabled, the API is being served over plain HTTP.")
+		return server.ListenAndServe()
+	}
+
+	var err error
+	server.TLSConfig, err = s.serverTLSConfig(s.Conf.TLS)
+	if err != nil {
+		return err
+	}
+	return server.ListenAndServeTLS("", "")
+}
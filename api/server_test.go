@@ -0,0 +1,429 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/command"
+	"github.com/altsrc-io/Jest/config"
+	"github.com/altsrc-io/Jest/host"
+	"github.com/altsrc-io/Jest/jail"
+	"github.com/altsrc-io/Jest/job"
+	"github.com/altsrc-io/Jest/snapshot"
+	"github.com/altsrc-io/Jest/template"
+	"github.com/altsrc-io/Jest/zfs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A mirror nothing listens on, so downloading FreeBSD fails straight away.
+const unreachableMirror = "127.0.0.1:1"
+
+// The fields the tests read from the responses.
+type testResponse struct {
+	Message  string
+	Error    *Error
+	Job      *job.Job
+	Jails    jail.Jail
+	Snapshot snapshot.Snapshot
+	Config   config.Config
+	DryRun   bool
+	Tokens   []Token
+	Secret   string
+}
+
+/*
+	A Server on its own MemoryStorage, served by an httptest.Server, and the bootstrap
+	token's secret to send with requests.
+*/
+type testServer struct {
+	*Server
+	Storage *zfs.MemoryStorage
+	Dir     string // The mountpoint of the Jest dataset
+	URL     string
+	Secret  string
+
+	http *httptest.Server
+}
+
+func (ts *testServer) Close() {
+	ts.http.Close()
+	if ts.IsInitialised {
+		ts.DB.Close()
+	}
+	os.RemoveAll(ts.Dir)
+}
+
+/*
+	Start a server on a MemoryStorage, which has only the pool if initialised isn't set.
+	If it is, the host is set up the way init leaves it, with the default template, as
+	init itself has to download FreeBSD.
+*/
+func newTestServer(t *testing.T, initialised bool) *testServer {
+	dir, err := ioutil.TempDir("", "jest-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := zfs.NewMemoryStorage("zroot")
+	if initialised {
+		storage.CreateFilesystem("zroot/jails", map[string]string{"mountpoint": dir})
+		storage.SetProperty("zroot/jails", "jest:dir", filepath.Join(dir, ".jest"))
+		storage.CreateFilesystem("zroot/jails/.jest", map[string]string{"mountpoint": filepath.Join(dir, ".jest")})
+		storage.CreateFilesystem("zroot/jails/.default", map[string]string{"mountpoint": filepath.Join(dir, ".default")})
+		storage.Snapshot("zroot/jails/.default", "Ready")
+		os.MkdirAll(filepath.Join(dir, ".jest"), 0700)
+	}
+
+	var out bytes.Buffer
+	s, err := NewServer(Options{Dataset: "zroot/jails", FTPMirror: unreachableMirror}, storage, &command.RecordingRunner{}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if initialised {
+		_, err = config.Save(s.DB, config.Config{JestDir: dir, JestDataset: "zroot/jails", DefaultTemplate: "default", JailDefaults: config.DefaultJailDefaults})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Conf, _ = config.Load(s.DB)
+
+		err = putTestTemplate(s.Host, "default", dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The secret is printed at the end of the first line.
+	fields := strings.Fields(strings.SplitN(out.String(), "\n", 2)[0])
+	if len(fields) == 0 {
+		t.Fatal("NewServer didn't print the bootstrap token.")
+	}
+
+	ts := &testServer{Server: s, Storage: storage, Dir: dir, Secret: fields[len(fields)-1]}
+	ts.http = httptest.NewServer(s.Handler())
+	ts.URL = ts.http.URL
+	return ts
+}
+
+// Record a template, the way init and the template jobs do once its dataset is ready.
+func putTestTemplate(h *host.Host, name string, dir string) error {
+	return template.Put(h, template.Template{Name: name, Path: filepath.Join(dir, "."+name), Version: "11.1-RELEASE", ZFSParams: host.ZFSParams{Name: "zroot/jails", Mountpoint: dir}})
+}
+
+// Send the request, decoding the response into res, and return the status code.
+func (ts *testServer) do(t *testing.T, method string, path string, body interface{}, res interface{}) int {
+	var encoded bytes.Buffer
+	if body != nil {
+		err := json.NewEncoder(&encoded).Encode(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, err := http.NewRequest(method, ts.URL+path, &encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+ts.Secret)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if res != nil {
+		err = json.NewDecoder(resp.Body).Decode(res)
+		if err != nil {
+			t.Fatalf("%s %s: couldn't decode the response: %s", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// Poll the job until it finishes.
+func (ts *testServer) waitForJob(t *testing.T, id string) *job.Job {
+	for i := 0; i < 100; i++ {
+		var res testResponse
+		status := ts.do(t, "GET", "/jobs/"+id, nil, &res)
+		if status != http.StatusOK || res.Job == nil {
+			t.Fatalf("GET /jobs/%s = %d, %s", id, status, res.Message)
+		}
+		if res.Job.Status != job.StatusRunning {
+			return res.Job
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	t.Fatalf("The job %s didn't finish.", id)
+	return nil
+}
+
+func (ts *testServer) createJail(t *testing.T, form jail.Config) {
+	var res testResponse
+	status := ts.do(t, "POST", "/jails", form, &res)
+	if status != http.StatusOK {
+		t.Fatalf("POST /jails %s = %d, %s", form.JailName, status, res.Message)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	ts := newTestServer(t, true)
+	defer ts.Close()
+
+	secret := ts.Secret
+	for _, ts.Secret = range []string{"", "not-a-token"} {
+		var res testResponse
+		status := ts.do(t, "GET", "/config", nil, &res)
+		if status != http.StatusUnauthorized {
+			t.Errorf("GET /config with the token %q = %d, %s, want %d", ts.Secret, status, res.Message, http.StatusUnauthorized)
+		}
+	}
+
+	ts.Secret = secret
+	if status := ts.do(t, "GET", "/config", nil, nil); status != http.StatusOK {
+		t.Errorf("GET /config with the bootstrap token = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestInit(t *testing.T) {
+	ts := newTestServer(t, false)
+	defer ts.Close()
+
+	var uninitialised testResponse
+	status := ts.do(t, "GET", "/jails", nil, &uninitialised)
+	if status != http.StatusConflict || uninitialised.Error == nil || uninitialised.Error.Code != CodeNotInitialised {
+		t.Errorf("GET /jails before init = %d, %+v, want %s", status, uninitialised.Error, CodeNotInitialised)
+	}
+
+	var invalid testResponse
+	status = ts.do(t, "POST", "/init", InitCreate{ZFSParams: host.ZFSParams{Name: "zroot/jails", Mountpoint: ts.Dir}, FreeBSDParams: template.FreeBSDParams{Name: "default", Version: "eleven"}}, &invalid)
+	if status != http.StatusUnprocessableEntity || invalid.Error == nil || invalid.Error.Code != CodeValidationFailed {
+		t.Errorf("POST /init with an invalid version = %d, %+v, want %s", status, invalid.Error, CodeValidationFailed)
+	}
+
+	// The job gets as far as downloading FreeBSD, which fails as the mirror isn't there.
+	var accepted testResponse
+	status = ts.do(t, "POST", "/init", InitCreate{ZFSParams: host.ZFSParams{Name: "zroot/jails", Mountpoint: ts.Dir}, FreeBSDParams: template.FreeBSDParams{Name: "default", Version: "11.1-RELEASE"}}, &accepted)
+	if status != http.StatusAccepted || accepted.Job == nil || accepted.Job.Type != job.TypeInit {
+		t.Fatalf("POST /init = %d, %+v, want an init job", status, accepted)
+	}
+
+	finished := ts.waitForJob(t, accepted.Job.ID)
+	if finished.Status != job.StatusFailed || finished.Step != "Downloading FreeBSD files." {
+		t.Errorf("The init job = %s at %q, want it to fail downloading FreeBSD", finished.Status, finished.Step)
+	}
+	if _, err := ts.Storage.GetDataset("zroot/jails/.default"); err != nil {
+		t.Errorf("The init job didn't create the template's dataset: %s", err)
+	}
+
+	ts.state.RLock()
+	initialised := ts.IsInitialised
+	ts.state.RUnlock()
+	if initialised {
+		t.Error("The host is initialised after the init job failed.")
+	}
+}
+
+func TestInitWhenInitialised(t *testing.T) {
+	ts := newTestServer(t, true)
+	defer ts.Close()
+
+	var res testResponse
+	status := ts.do(t, "POST", "/init", InitCreate{ZFSParams: host.ZFSParams{Name: "zroot/jails", Mountpoint: ts.Dir}, FreeBSDParams: template.FreeBSDParams{Name: "default", Version: "11.1-RELEASE"}}, &res)
+	if status != http.StatusConflict || res.Error == nil || res.Error.Code != CodeAlreadyInitialised {
+		t.Errorf("POST /init = %d, %+v, want %s", status, res.Error, CodeAlreadyInitialised)
+	}
+}
+
+func TestDeinitWaitsForTemplateJobs(t *testing.T) {
+	ts := newTestServer(t, true)
+	defer ts.Close()
+
+	// A template job which is still running, it's failed by hand below.
+	creating := ts.Jobs.New(job.TypeTemplate, "")
+
+	var res testResponse
+	status := ts.do(t, "DELETE", "/init", InitDelete{}, &res)
+	if status != http.StatusConflict || res.Error == nil || res.Error.Code != CodeConflict {
+		t.Errorf("DELETE /init while a template job is running = %d, %+v, want %s", status, res.Error, CodeConflict)
+	}
+	if _, err := ts.Storage.GetDataset("zroot/jails/.default"); err != nil {
+		t.Errorf("The refused de-init destroyed a dataset: %s", err)
+	}
+
+	creating.Fail("Failed to create the template.", fmt.Errorf("Cancelled by the test."))
+	res = testResponse{}
+	if status := ts.do(t, "DELETE", "/init", InitDelete{DryRun: true}, &res); status != http.StatusOK || res.DryRun == false {
+		t.Errorf("DELETE /init as a dry run once the job finished = %d, %s", status, res.Message)
+	}
+}
+
+func TestCreateTemplate(t *testing.T) {
+	ts := newTestServer(t, true)
+	defer ts.Close()
+
+	var res testResponse
+	status := ts.do(t, "POST", "/templates/default", template.FreeBSDParams{Version: "11.1-RELEASE"}, &res)
+	if status != http.StatusConflict || res.Error == nil || res.Error.Code != CodeNameInUse {
+		t.Errorf("POST /templates/default = %d, %+v, want %s", status, res.Error, CodeNameInUse)
+	}
+
+	status = ts.do(t, "POST", "/templates/web", template.FreeBSDParams{Version: "latest"}, &res)
+	if status != http.StatusUnprocessableEntity || res.Error == nil || res.Error.Code != CodeValidationFailed {
+		t.Errorf("POST /templates/web with an invalid version = %d, %+v, want %s", status, res.Error, CodeValidationFailed)
+	}
+
+	var accepted testResponse
+	status = ts.do(t, "POST", "/templates/web", template.FreeBSDParams{Version: "11.1-RELEASE"}, &accepted)
+	if status != http.StatusAccepted || accepted.Job == nil || accepted.Job.Type != job.TypeTemplate {
+		t.Fatalf("POST /templates/web = %d, %+v, want a template job", status, accepted)
+	}
+
+	finished := ts.waitForJob(t, accepted.Job.ID)
+	if finished.Status != job.StatusFailed {
+		t.Errorf("The template job = %s, want it to fail downloading FreeBSD", finished.Status)
+	}
+
+	// A template which fails is cleaned up, so the request can be retried.
+	if _, err := ts.Storage.GetDataset("zroot/jails/.web"); err == nil {
+		t.Error("The failed template job left its dataset behind.")
+	}
+	if status := ts.do(t, "GET", "/templates/web", nil, &res); status != http.StatusNotFound {
+		t.Errorf("GET /templates/web = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestJailLifecycle(t *testing.T) {
+	ts := newTestServer(t, true)
+	defer ts.Close()
+
+	ts.createJail(t, jail.Config{JailName: "mash", Hostname: "mash.local", IPV4Addr: "10.0.2.12", UseDefaults: true})
+
+	var res testResponse
+	status := ts.do(t, "POST", "/jails", jail.Config{JailName: "mash", Hostname: "mash2.local", IPV4Addr: "10.0.2.13", UseDefaults: true}, &res)
+	if status != http.StatusConflict || res.Error == nil || res.Error.Code != CodeNameInUse {
+		t.Errorf("POST /jails with the same name = %d, %+v, want %s", status, res.Error, CodeNameInUse)
+	}
+
+	var got testResponse
+	status = ts.do(t, "GET", "/jails/mash", nil, &got)
+	if status != http.StatusOK || got.Jails.JailConfig.Template != "default" || got.Jails.Owner != "bootstrap" {
+		t.Errorf("GET /jails/mash = %d, %+v, want the jail cloned from the default template", status, got.Jails)
+	}
+	if _, err := ts.Storage.GetDataset("zroot/jails/mash"); err != nil {
+		t.Errorf("The jail wasn't cloned: %s", err)
+	}
+
+	var snap testResponse
+	status = ts.do(t, "POST", "/snapshots", SnapshotCreate{Name: "mash@before"}, &snap)
+	if status != http.StatusCreated || snap.Snapshot.Dataset != "zroot/jails/mash@before" || snap.Snapshot.JailConfig.JailName != "mash" {
+		t.Errorf("POST /snapshots = %d, %+v, want the jail's snapshot", status, snap)
+	}
+
+	snap = testResponse{}
+	status = ts.do(t, "GET", "/snapshots/mash@before", nil, &snap)
+	if status != http.StatusOK || snap.Snapshot.Target != "mash" {
+		t.Errorf("GET /snapshots/mash@before = %d, %+v", status, snap)
+	}
+
+	// The dataset can't be destroyed with the snapshot, unless it's asked for.
+	status = ts.do(t, "DELETE", "/jails/mash", nil, &res)
+	if status != http.StatusInternalServerError {
+		t.Errorf("DELETE /jails/mash with a snapshot = %d, want %d", status, http.StatusInternalServerError)
+	}
+
+	status = ts.do(t, "DELETE", "/jails/mash", JailDelete{DestroySnapshots: true}, &res)
+	if status != http.StatusOK {
+		t.Fatalf("DELETE /jails/mash = %d, %s", status, res.Message)
+	}
+	if _, err := ts.Storage.GetDataset("zroot/jails/mash"); err == nil {
+		t.Error("The jail's dataset is still there after it was deleted.")
+	}
+
+	status = ts.do(t, "GET", "/snapshots/mash@before", nil, &snap)
+	if status != http.StatusNotFound {
+		t.Errorf("GET /snapshots/mash@before after deleting the jail = %d, want %d", status, http.StatusNotFound)
+	}
+	status = ts.do(t, "GET", "/jails/mash", nil, &got)
+	if status != http.StatusNotFound {
+		t.Errorf("GET /jails/mash after deleting it = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestCloneDependencies(t *testing.T) {
+	ts := newTestServer(t, true)
+	defer ts.Close()
+
+	ts.Storage.CreateFilesystem("zroot/jails/.web", map[string]string{"mountpoint": filepath.Join(ts.Dir, ".web")})
+	ts.Storage.Snapshot("zroot/jails/.web", "Ready")
+	err := putTestTemplate(ts.Host, "web", ts.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts.createJail(t, jail.Config{JailName: "pie", Hostname: "pie.local", IPV4Addr: "10.0.2.14", Template: "web", UseDefaults: true})
+
+	var res testResponse
+	status := ts.do(t, "DELETE", "/templates/default", nil, &res)
+	if status != http.StatusConflict || res.Error == nil || res.Error.Code != CodeConflict {
+		t.Errorf("DELETE /templates/default = %d, %+v, want %s as it's the DefaultTemplate", status, res.Error, CodeConflict)
+	}
+
+	status = ts.do(t, "DELETE", "/templates/web", nil, &res)
+	if status != http.StatusConflict || res.Message != "Template is still in use." {
+		t.Errorf("DELETE /templates/web = %d, %s, want %d as pie is cloned from it", status, res.Message, http.StatusConflict)
+	}
+
+	status = ts.do(t, "DELETE", "/snapshots/.web@Ready", nil, &res)
+	if status != http.StatusConflict || res.Error == nil || res.Error.Code != CodeConflict {
+		t.Errorf("DELETE /snapshots/.web@Ready = %d, %+v, want %s", status, res.Error, CodeConflict)
+	}
+
+	status = ts.do(t, "DELETE", "/jails/pie", nil, &res)
+	if status != http.StatusOK {
+		t.Fatalf("DELETE /jails/pie = %d, %s", status, res.Message)
+	}
+
+	status = ts.do(t, "DELETE", "/templates/web", nil, &res)
+	if status != http.StatusOK {
+		t.Errorf("DELETE /templates/web once nothing is cloned from it = %d, %s", status, res.Message)
+	}
+	if _, err := ts.Storage.GetDataset("zroot/jails/.web"); err == nil {
+		t.Error("The template's dataset is still there after it was deleted.")
+	}
+}
+
+func TestServersAreIndependent(t *testing.T) {
+	first := newTestServer(t, true)
+	defer first.Close()
+	second := newTestServer(t, true)
+	defer second.Close()
+
+	// The same jail on both, as neither sees the other's jails.
+	first.createJail(t, jail.Config{JailName: "mash", Hostname: "mash.local", IPV4Addr: "10.0.2.12", UseDefaults: true})
+	second.createJail(t, jail.Config{JailName: "mash", Hostname: "mash.local", IPV4Addr: "10.0.2.12", UseDefaults: true})
+	second.createJail(t, jail.Config{JailName: "pie", Hostname: "pie.local", IPV4Addr: "10.0.2.13", UseDefaults: true})
+
+	for ts, want := range map[*testServer]int{first: 1, second: 2} {
+		var jails struct{ Jails []jail.Jail }
+		status := ts.do(t, "GET", "/jails", nil, &jails)
+		if status != http.StatusOK || len(jails.Jails) != want {
+			t.Errorf("GET /jails = %d, %d jails, want the %d on its own storage", status, len(jails.Jails), want)
+		}
+	}
+
+	// Each has its own tokens.
+	other := *first
+	other.Secret = second.Secret
+	if status := other.do(t, "GET", "/jails", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("GET /jails with the other server's token = %d, want %d", status, http.StatusUnauthorized)
+	}
+}
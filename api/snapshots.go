@@ -0,0 +1,329 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/jail"
+	"github.com/altsrc-io/Jest/model"
+	"github.com/altsrc-io/Jest/snapshot"
+	"github.com/altsrc-io/Jest/template"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type (
+	SnapshotCreate    model.SnapshotCreate
+	SnapshotRollback  model.SnapshotRollback
+	SnapshotsResponse model.SnapshotsResponse
+	SnapshotResponse  model.SnapshotResponse
+)
+
+func (s *Server) ListSnapshotsEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received a get snapshots request from " + r.RemoteAddr)
+
+	snapshots, err := snapshot.List(s.Host)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := SnapshotsResponse{"Failed to list the ZFS snapshots.", newError(CodeInternal, err), snapshots}
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	if len(snapshots) < 1 {
+		w.WriteHeader(http.StatusNotFound)
+		res := SnapshotsResponse{"No snapshots found.", newError(CodeNotFound, fmt.Errorf("There are no snapshots on this host.")), snapshots}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	res := SnapshotsResponse{"Snapshots found.", nil, snapshots}
+	log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+func (s *Server) GetSnapshotEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received a get snapshot request from " + r.RemoteAddr)
+	vars := mux.Vars(r)
+
+	snapshots, err := snapshot.List(s.Host)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := SnapshotResponse{"Failed to list the ZFS snapshots.", newError(CodeInternal, err), snapshot.Snapshot{}}
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	snap, err := snapshot.Find(vars["name"], snapshots)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		res := SnapshotResponse{"Snapshot not found.", newError(CodeNotFound, err), snapshot.Snapshot{}}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	res := SnapshotResponse{"Snapshot found.", nil, snap}
+	log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+func (s *Server) CreateSnapshotEndpoint(w http.ResponseWriter, r *http.Request) {
+	var form SnapshotCreate
+	log.Info("Received a create snapshot request from " + r.RemoteAddr)
+	vars := mux.Vars(r)
+
+	if vars["name"] != "" {
+		form.Name = vars["name"]
+	} else {
+		log.Debug("Decoding the JSON request.")
+		err := json.NewDecoder(r.Body).Decode(&form)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			res := SnapshotResponse{"Failed to decode the JSON request", newError(CodeInvalidRequest, err), snapshot.Snapshot{}}
+			json.NewEncoder(w).Encode(res)
+			log.WithFields(log.Fields{"request": form, "error": err}).Warn(res.Message)
+			return
+		}
+		log.WithFields(log.Fields{"request": form}).Debug("Decoded JSON request.")
+	}
+
+	target, snapName, err := snapshot.ParseName(form.Name)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		res := SnapshotResponse{"Invalid snapshot name.", invalidField("Name", err), snapshot.Snapshot{}}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	snap := snapshot.Snapshot{Name: form.Name, Target: strings.TrimPrefix(target, "."), IsTemplate: strings.HasPrefix(target, ".")}
+
+	if snap.IsTemplate {
+		_, err = template.Find(snap.Target, template.List(s.Host))
+	} else {
+		snap.JailConfig, err = jail.GetConfig(s.Host, snap.Target)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		res := SnapshotResponse{"Couldn't find the jail or template to snapshot.", newError(CodeNotFound, err), snapshot.Snapshot{}}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	dataset, err := s.Storage.GetDataset(snapshot.DatasetName(s.Host, target))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := SnapshotResponse{"Couldn't find the ZFS dataset to snapshot.", newError(CodeInternal, err), snapshot.Snapshot{}}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	log.WithFields(log.Fields{"dataset": dataset.Name, "snapshot": snapName}).Debug("Taking snapshot.")
+	zfsSnapshot, err := s.Storage.Snapshot(dataset.Name, snapName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := SnapshotResponse{"Failed to take the snapshot.", newError(CodeInternal, err), snapshot.Snapshot{}}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+	snap.Dataset = zfsSnapshot.Name
+	snap.Used = zfsSnapshot.Used
+
+	err = snapshot.PutRecord(s.Host, snap)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := SnapshotResponse{"Took the snapshot but failed to record it in the DB.", newError(CodeInternal, err), snap}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	res := SnapshotResponse{"Snapshot created successfully.", nil, snap}
+	log.WithFields(log.Fields{"error": res.Error, "snapshot": snap.Dataset}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+func (s *Server) RollbackSnapshotEndpoint(w http.ResponseWriter, r *http.Request) {
+	var form SnapshotRollback
+	log.Info("Received a rollback snapshot request from " + r.RemoteAddr)
+	vars := mux.Vars(r)
+
+	log.Debug("Decoding the JSON request.")
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil && err != io.EOF {
+		w.WriteHeader(http.StatusBadRequest)
+		res := SnapshotResponse{"Failed to decode the JSON request", newError(CodeInvalidRequest, err), snapshot.Snapshot{}}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"request": form, "error": err}).Warn(res.Message)
+		return
+	}
+
+	snapshots, err := snapshot.List(s.Host)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := SnapshotResponse{"Failed to list the ZFS snapshots.", newError(CodeInternal, err), snapshot.Snapshot{}}
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	snap, err := snapshot.Find(vars["name"], snapshots)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		res := SnapshotResponse{"Snapshot not found.", newError(CodeNotFound, err), snapshot.Snapshot{}}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	if snap.IsTemplate == false {
+		conf, err := jail.GetConfig(s.Host, snap.Target)
+		if err == nil {
+			state, _ := jail.Status(s.Host, conf)
+			if state.Running {
+				w.WriteHeader(http.StatusConflict)
+				res := SnapshotResponse{"Cannot roll back a running jail.", newError(CodeConflict, fmt.Errorf("The jail " + snap.Target + " must be stopped before it can be rolled back.")), snap}
+				log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+				json.NewEncoder(w).Encode(res)
+				return
+			}
+		}
+	}
+
+	/*
+		The config is checked before anything is rolled back, as another jail may have
+		taken its hostname or IP since, or a jail it depends on may have been deleted.
+	*/
+	if snap.IsTemplate == false && snap.JailConfig.JailName != "" {
+		err = jail.ValidateUpdate(s.Host, snap.JailConfig)
+		if err != nil {
+			status, formErr := jailFormError(err)
+			w.WriteHeader(status)
+			res := SnapshotResponse{"The jail config in the snapshot can't be restored.", formErr, snap}
+			log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+			json.NewEncoder(w).Encode(res)
+			return
+		}
+	}
+
+	zfsSnapshot, err := s.Storage.GetDataset(snap.Dataset)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := SnapshotResponse{"Couldn't find the ZFS snapshot.", newError(CodeInternal, err), snap}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	log.WithFields(log.Fields{"snapshot": snap.Dataset, "destroyMoreRecent": form.DestroyMoreRecent}).Debug("Rolling back snapshot.")
+	err = s.Storage.Rollback(zfsSnapshot.Name, form.DestroyMoreRecent)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := SnapshotResponse{"Failed to roll back to the snapshot.", newError(CodeInternal, err), snap}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	if form.DestroyMoreRecent {
+		err = snapshot.Prune(s.Host)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Warn("Failed to remove the records of the destroyed snapshots.")
+		}
+	}
+
+	// Snapshots taken before Jest recorded configs won't have one to restore.
+	if snap.IsTemplate == false && snap.JailConfig.JailName != "" {
+		log.WithFields(log.Fields{"jail": snap.Target}).Debug("Restoring the jail config from the snapshot.")
+		err = jail.UpdateConfig(s.Host, snap.Target, snap.JailConfig)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			res := SnapshotResponse{"Rolled back the dataset but failed to restore the jail config.", newError(CodeInternal, err), snap}
+			json.NewEncoder(w).Encode(res)
+			log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	res := SnapshotResponse{"Rolled back to the snapshot successfully.", nil, snap}
+	log.WithFields(log.Fields{"error": res.Error, "snapshot": snap.Dataset}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+func (s *Server) DeleteSnapshotEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received a delete snapshot request from " + r.RemoteAddr)
+	vars := mux.Vars(r)
+
+	snapshots, err := snapshot.List(s.Host)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := SnapshotResponse{"Failed to list the ZFS snapshots.", newError(CodeInternal, err), snapshot.Snapshot{}}
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	snap, err := snapshot.Find(vars["name"], snapshots)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		res := SnapshotResponse{"Snapshot not found.", newError(CodeNotFound, err), snapshot.Snapshot{}}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	// Every jail is cloned from its template's Ready snapshot.
+	if snap.IsTemplate && strings.HasSuffix(snap.Name, "@Ready") {
+		w.WriteHeader(http.StatusConflict)
+		res := SnapshotResponse{"Cannot delete a template's Ready snapshot.", newError(CodeConflict, fmt.Errorf("The snapshot " + snap.Name + " is used to create jails from the template " + snap.Target + ".")), snap}
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	zfsSnapshot, err := s.Storage.GetDataset(snap.Dataset)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := SnapshotResponse{"Couldn't find the ZFS snapshot.", newError(CodeInternal, err), snap}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	err = s.Storage.Destroy(zfsSnapshot.Name, false)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := SnapshotResponse{"Failed to destroy the snapshot.", newError(CodeInternal, err), snap}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	err = snapshot.Prune(s.Host)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Warn("Failed to remove the record of the destroyed snapshot.")
+	}
+
+	w.WriteHeader(http.StatusOK)
+	res := SnapshotResponse{"Snapshot deleted.", nil, snap}
+	log.WithFields(log.Fields{"error": res.Error, "snapshot": snap.Dataset}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/jail"
+	"github.com/altsrc-io/Jest/job"
+	"github.com/altsrc-io/Jest/model"
+	"github.com/altsrc-io/Jest/snapshot"
+	"github.com/altsrc-io/Jest/template"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type (
+	TemplatesResponse      model.TemplatesResponse
+	TemplateResponse       model.TemplateResponse
+	CreateTemplateResponse model.CreateTemplateResponse
+	TemplateUpdate         model.TemplateUpdate
+)
+
+func (s *Server) ListTemplatesEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received a get template request from " + r.RemoteAddr)
+
+	templates := template.List(s.Host)
+
+	if len(templates) < 1 {
+		w.WriteHeader(http.StatusNotFound)
+		res := TemplatesResponse{"No templates found.", newError(CodeNotFound, fmt.Errorf("There are no templates enabled on this host.")), templates}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	res := TemplatesResponse{"Templates found.", nil, templates}
+	log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+func (s *Server) GetTemplateEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received a get template request from " + r.RemoteAddr)
+	vars := mux.Vars(r)
+
+	templates := template.List(s.Host)
+
+	if len(templates) < 1 {
+		w.WriteHeader(http.StatusNotFound)
+		res := TemplateResponse{"No template found.", newError(CodeNotFound, fmt.Errorf("There are no template enabled on this host.")), template.Template{}}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	t, err := template.Find(vars["name"], templates)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		res := TemplateResponse{"Template not found.", newError(CodeNotFound, fmt.Errorf("There is no template on this host with the name " + vars["name"])), template.Template{}}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	res := TemplateResponse{"Template found.", nil, t}
+	log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+func (s *Server) CreateTemplateEndpoint(w http.ResponseWriter, r *http.Request) {
+	var form template.FreeBSDParams
+	log.Info("Received a create template request from " + r.RemoteAddr)
+	vars := mux.Vars(r)
+
+	log.Debug("Decoding the JSON request.")
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		res := CreateTemplateResponse{"Failed to decode the JSON request", newError(CodeInvalidRequest, err), template.Template{}, ""}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"request": form, "error": err}).Warn(res.Message)
+		return
+	}
+	log.WithFields(log.Fields{"request": form}).Debug("Decoded JSON request.")
+
+	if vars["name"] != "" {
+		form.Name = vars["name"]
+	}
+
+	err = template.ValidateName(form.Name)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		res := CreateTemplateResponse{"Invalid template name.", invalidField("Name", err), template.Template{}, ""}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	err = template.ValidateVersion(form.Version)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		res := CreateTemplateResponse{"Invalid FreeBSD Version specified.", invalidField("Version", err), template.Template{}, ""}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	_, err = template.Find(form.Name, template.List(s.Host))
+	if err == nil {
+		w.WriteHeader(http.StatusConflict)
+		res := CreateTemplateResponse{"Template already exists.", &Error{Code: CodeNameInUse, Message: "Template name already in use: " + form.Name + ".", Details: map[string]string{"Field": "Name", "Value": form.Name}}, template.Template{}, ""}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	// The job outlives the request, so it works on a copy of the host rather than the shared state.
+	h := *s.Host
+	j := s.Jobs.New(job.TypeTemplate, requestToken(r).ID)
+	go func() {
+		t, pw, err := template.Create(&h, j, form)
+		if err != nil {
+			j.Fail("Failed to create the template "+form.Name+".", err)
+			return
+		}
+
+		// The password is only returned once, to whoever created the template.
+		res := CreateTemplateResponse{"Template created successfully.", nil, t, ""}
+		secret := res
+		secret.Password = pw
+		j.SucceedWithSecret(res, secret)
+	}()
+
+	writeJobAccepted(w, j, "Creating the template, poll the job for progress.")
+}
+
+func (s *Server) UpdateTemplateEndpoint(w http.ResponseWriter, r *http.Request) {
+	var form TemplateUpdate
+	log.Info("Received an update template request from " + r.RemoteAddr)
+	vars := mux.Vars(r)
+
+	log.Debug("Decoding the JSON request.")
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		res := TemplateResponse{"Failed to decode the JSON request", newError(CodeInvalidRequest, err), template.Template{}}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"request": form, "error": err}).Warn(res.Message)
+		return
+	}
+	log.WithFields(log.Fields{"request": form}).Debug("Decoded JSON request.")
+
+	t, err := template.SetDisabled(s.Host, vars["name"], form.Disabled)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		res := TemplateResponse{"Couldn't update the template.", newError(CodeNotFound, err), template.Template{}}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	res := TemplateResponse{"Template updated.", nil, t}
+	log.WithFields(log.Fields{"error": res.Error, "template": t.Name}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+func (s *Server) DeleteTemplateEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received a delete template request from " + r.RemoteAddr)
+	vars := mux.Vars(r)
+	tName := vars["name"]
+
+	t, err := template.Find(tName, template.List(s.Host))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		res := TemplateResponse{"Template not found.", newError(CodeNotFound, err), template.Template{}}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		return
+	}
+
+	// Every jail created without a template would fail once the default is gone.
+	if tName == s.Conf.DefaultTemplate {
+		w.WriteHeader(http.StatusConflict)
+		res := TemplateResponse{"Template is the default.", newError(CodeConflict, fmt.Errorf("The template %s is the config's DefaultTemplate, change the DefaultTemplate before deleting it.", tName)), t}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	jails := jail.ClonedFrom(s.Host, tName)
+	if len(jails) > 0 {
+		w.WriteHeader(http.StatusConflict)
+		res := TemplateResponse{"Template is still in use.", newError(CodeConflict, fmt.Errorf("The template %s can't be deleted while these jails are cloned from it: %v", tName, jails)), t}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	err = template.DestroyDataset(s.Host, tName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := TemplateResponse{"Failed to destroy the template dataset.", newError(CodeInternal, err), t}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	err = template.DeleteRecord(s.Host, tName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := TemplateResponse{"Destroyed the template dataset but failed to remove it from the DB.", newError(CodeInternal, err), t}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	err = snapshot.Prune(s.Host)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Warn("Failed to remove the records of the destroyed snapshots.")
+	}
+
+	w.WriteHeader(http.StatusOK)
+	res := TemplateResponse{"Template deleted.", nil, t}
+	log.WithFields(log.Fields{"error": res.Error, "template": t.Name}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"github.com/altsrc-io/Jest/config"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+	Without a certificate in the config Jest uses a self-signed one it generates under JestDir.
+	Before the host is initialised there is no JestDir, so the self-signed certificate
+	is only held in memory until init writes it out, and it's used from then on.
+*/
+func (s *Server) selfSignedPaths() (string, string) {
+	return filepath.Join(s.JestDir, "tls", "cert.pem"), filepath.Join(s.JestDir, "tls", "key.pem")
+}
+
+// Generate a self-signed certificate for the host's name and addresses, returned PEM encoded.
+func generateSelfSignedCertificate() ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Jest"}, CommonName: hostname},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+	}
+	if hostname != "" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+
+	addrs, _ := net.InterfaceAddrs()
+	for a := range addrs {
+		if ipNet, ok := addrs[a].(*net.IPNet); ok {
+			template.IPAddresses = append(template.IPAddresses, ipNet.IP)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), nil
+}
+
+// The self-signed certificate, generating it the first time it's needed.
+func (s *Server) selfSignedCertificate() ([]byte, []byte, error) {
+	s.selfSigned.Lock()
+	defer s.selfSigned.Unlock()
+
+	if s.IsInitialised {
+		certPath, keyPath := s.selfSignedPaths()
+		cert, certErr := ioutil.ReadFile(certPath)
+		key, keyErr := ioutil.ReadFile(keyPath)
+		if certErr == nil && keyErr == nil {
+			return cert, key, nil
+		}
+	}
+
+	if s.selfSigned.cert == nil {
+		log.Info("Generating a self-signed TLS certificate.")
+		cert, key, err := generateSelfSignedCertificate()
+		if err != nil {
+			return nil, nil, err
+		}
+		s.selfSigned.cert, s.selfSigned.key = cert, key
+	}
+
+	if s.IsInitialised {
+		return s.selfSigned.cert, s.selfSigned.key, s.writeSelfSignedCertificate()
+	}
+	return s.selfSigned.cert, s.selfSigned.key, nil
+}
+
+// Write the self-signed certificate under JestDir, unless one is already there.
+func (s *Server) writeSelfSignedCertificate() error {
+	if s.selfSigned.cert == nil {
+		return nil
+	}
+
+	certPath, keyPath := s.selfSignedPaths()
+	if _, err := os.Stat(certPath); err == nil {
+		return nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(certPath), 0700)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"fileName": certPath}).Debug("Writing the self-signed TLS certificate.")
+	err = ioutil.WriteFile(keyPath, s.selfSigned.key, 0600)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(certPath, s.selfSigned.cert, 0644)
+}
+
+// Keep the self-signed certificate the API is being served with once init has created JestDir.
+func (s *Server) saveSelfSignedCertificate() error {
+	s.selfSigned.Lock()
+	defer s.selfSigned.Unlock()
+
+	return s.writeSelfSignedCertificate()
+}
+
+func certificateFingerprint(cert tls.Certificate) string {
+	if len(cert.Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	return hex.EncodeToString(sum[:])
+}
+
+// Build the tls.Config for the listener from the TLSConfig.
+func (s *Server) serverTLSConfig(c config.TLSConfig) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+
+	if c.CertFile != "" {
+		cert, err = tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	} else {
+		var certPEM, keyPEM []byte
+		certPEM, keyPEM, err = s.selfSignedCertificate()
+		if err == nil {
+			cert, err = tls.X509KeyPair(certPEM, keyPEM)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load the TLS certificate: %s", err)
+	}
+	log.WithFields(log.Fields{"sha256": certificateFingerprint(cert), "certFile": c.CertFile}).Info("Serving the API with TLS.")
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if c.ClientCAFile != "" {
+		bundle, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read the client CA bundle: %s", err)
+		}
+
+		pool := x509.NewCertPool()
+		if pool.AppendCertsFromPEM(bundle) == false {
+			return nil, fmt.Errorf("The client CA bundle %s doesn't contain any PEM certificates.", c.ClientCAFile)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if c.RequireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		log.WithFields(log.Fields{"clientCAFile": c.ClientCAFile, "required": c.RequireClientCert}).Info("Verifying client certificates.")
+	} else if c.RequireClientCert {
+		return nil, fmt.Errorf("RequireClientCert needs a ClientCAFile to verify the client certificates against.")
+	}
+
+	return config, nil
+}
@@ -0,0 +1,375 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/store"
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+	An API token. Only the SHA-256 hash of the secret is kept, the secret itself is
+	returned once when the token is created and can't be recovered afterwards.
+	Every request has to send a secret in an "Authorization: Bearer <secret>" header.
+*/
+type Token struct {
+	ID      string
+	Name    string // Who the token belongs to, the owner of the jails it creates
+	Role    string
+	Hash    string `json:",omitempty"`
+	Created time.Time
+}
+
+type TokenCreate struct {
+	Name string
+	Role string // Defaults to developer
+}
+
+type TokenResponse struct {
+	Message string
+	Error   *Error
+	Token   Token
+	Secret  string // Only set when the token is created
+}
+
+type TokensResponse struct {
+	Message string
+	Error   *Error
+	Tokens  []Token
+}
+
+type AuthResponse struct {
+	Message string
+	Error   *Error
+}
+
+type contextKey string
+
+const tokenContextKey = contextKey("token")
+
+/*
+	The bootstrap token lets the first requests, including POST /init, authenticate before
+	there is a DB to keep tokens in. Until the host is initialised it's only held in memory,
+	so a new one is printed each time Jest starts, and init saves it to the tokens bucket.
+*/
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func newTokenSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func newToken(name string, role string) (Token, string, error) {
+	secret, err := newTokenSecret()
+	if err != nil {
+		return Token{}, "", err
+	}
+
+	return Token{uuid.NewV4().String(), name, role, hashToken(secret), time.Now()}, secret, nil
+}
+
+func (s *Server) putToken(token Token) error {
+	encoded, err := json.Marshal(token)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "token": token.ID}).Warn("Failed to encode the struct to JSON before writing to the JestDB.")
+		return err
+	}
+
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.TokensBucket)
+		return b.Put([]byte(token.ID), encoded)
+	})
+}
+
+// ToDo: Add error handling here
+func (s *Server) listAllTokens() []Token {
+	var tokens = []Token{}
+
+	if s.IsInitialised == false {
+		return tokens
+	}
+
+	s.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.TokensBucket)
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			token := Token{}
+			err := json.NewDecoder(bytes.NewReader(v)).Decode(&token)
+			if err != nil {
+				log.Warn("Couldn't decode a key:", err)
+				continue
+			}
+
+			// Tokens created before there were roles could already do anything.
+			if token.Role == "" {
+				token.Role = RoleAdmin
+			}
+
+			tokens = append(tokens, token)
+		}
+		return nil
+	})
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Created.Before(tokens[j].Created)
+	})
+
+	return tokens
+}
+
+func (s *Server) deleteToken(id string) error {
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.TokensBucket)
+		if b.Get([]byte(id)) == nil {
+			return fmt.Errorf("There is no token with the ID " + id + ".")
+		}
+		return b.Delete([]byte(id))
+	})
+}
+
+/*
+	Make sure there is a way in: if there are no tokens yet, create a bootstrap token and
+	print its secret. Called on start up and after the host is de-initialised.
+*/
+func (s *Server) setupBootstrapToken() error {
+	if len(s.listAllTokens()) > 0 {
+		return nil
+	}
+
+	token, secret, err := newToken("bootstrap", RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	if s.IsInitialised {
+		err = s.putToken(token)
+		if err != nil {
+			return err
+		}
+	} else {
+		s.bootstrapToken.Lock()
+		s.bootstrapToken.pending = &token
+		s.bootstrapToken.Unlock()
+	}
+
+	fmt.Fprintln(s.Out, "Bootstrap API token, it won't be shown again:", secret)
+	fmt.Fprintln(s.Out, "Send it in an \"Authorization: Bearer <token>\" header.")
+	log.WithFields(log.Fields{"token": token.ID}).Info("Created the bootstrap API token.")
+	return nil
+}
+
+// Move the bootstrap token into the tokens bucket once init has created the DB.
+func (s *Server) saveBootstrapToken() error {
+	s.bootstrapToken.Lock()
+	defer s.bootstrapToken.Unlock()
+
+	if s.bootstrapToken.pending == nil {
+		return nil
+	}
+
+	err := s.putToken(*s.bootstrapToken.pending)
+	if err != nil {
+		return err
+	}
+	s.bootstrapToken.pending = nil
+	return nil
+}
+
+// Find the token the secret belongs to.
+func (s *Server) authenticateToken(secret string) (Token, error) {
+	hash := hashToken(secret)
+
+	s.bootstrapToken.Lock()
+	pending := s.bootstrapToken.pending
+	s.bootstrapToken.Unlock()
+
+	candidates := s.listAllTokens()
+	if pending != nil {
+		candidates = append(candidates, *pending)
+	}
+
+	for t := range candidates {
+		if subtle.ConstantTimeCompare([]byte(candidates[t].Hash), []byte(hash)) == 1 {
+			return candidates[t], nil
+		}
+	}
+
+	return Token{}, fmt.Errorf("The API token is not valid.")
+}
+
+// The token the request was authenticated with.
+func requestToken(r *http.Request) Token {
+	token, _ := r.Context().Value(tokenContextKey).(Token)
+	return token
+}
+
+// Rejects any request without a valid API token.
+func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if strings.HasPrefix(header, "Bearer ") == false {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			res := AuthResponse{"Authentication required.", newError(CodeUnauthenticated, fmt.Errorf("Send an API token in an \"Authorization: Bearer <token>\" header."))}
+			log.WithFields(log.Fields{"error": res.Error, "remote": r.RemoteAddr, "path": r.URL.Path}).Warn(res.Message)
+			json.NewEncoder(w).Encode(res)
+			return
+		}
+
+		token, err := s.authenticateToken(strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer error=\"invalid_token\"")
+			w.WriteHeader(http.StatusUnauthorized)
+			res := AuthResponse{"Authentication failed.", newError(CodeUnauthenticated, err)}
+			log.WithFields(log.Fields{"error": res.Error, "remote": r.RemoteAddr, "path": r.URL.Path}).Warn(res.Message)
+			json.NewEncoder(w).Encode(res)
+			return
+		}
+
+		log.WithFields(log.Fields{"token": token.ID, "name": token.Name}).Debug("Authenticated request.")
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenContextKey, token)))
+	})
+}
+
+func (s *Server) ListTokensEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received a list tokens request from " + r.RemoteAddr)
+
+	tokens := s.listAllTokens()
+	for t := range tokens {
+		tokens[t].Hash = ""
+	}
+
+	w.WriteHeader(http.StatusOK)
+	res := TokensResponse{"Tokens found.", nil, tokens}
+	log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+func (s *Server) CreateTokenEndpoint(w http.ResponseWriter, r *http.Request) {
+	var form TokenCreate
+	log.Info("Received a create token request from " + r.RemoteAddr)
+
+	log.Debug("Decoding the JSON request.")
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		res := TokenResponse{"Failed to decode the JSON request", newError(CodeInvalidRequest, err), Token{}, ""}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"request": form, "error": err}).Warn(res.Message)
+		return
+	}
+
+	if form.Name == "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		res := TokenResponse{"Invalid token.", invalidField("Name", fmt.Errorf("The token needs a Name, so you can tell it apart from the others.")), Token{}, ""}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	if form.Role == "" {
+		form.Role = RoleDeveloper
+	}
+	err = validateRole(form.Role)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		res := TokenResponse{"Invalid token.", invalidField("Role", err), Token{}, ""}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+
+	token, secret, err := newToken(form.Name, form.Role)
+	if err == nil {
+		err = s.putToken(token)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		res := TokenResponse{"Failed to create the token.", newError(CodeInternal, err), Token{}, ""}
+		json.NewEncoder(w).Encode(res)
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		return
+	}
+	token.Hash = ""
+
+	w.WriteHeader(http.StatusCreated)
+	res := TokenResponse{"Token created, the secret won't be shown again.", nil, token, secret}
+	log.WithFields(log.Fields{"error": res.Error, "token": token.ID, "role": token.Role, "createdBy": requestToken(r).ID}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+func (s *Server) DeleteTokenEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received a delete token request from " + r.RemoteAddr)
+	vars := mux.Vars(r)
+
+	// Nobody could make another request, or create a new token, without one.
+	if tokens := s.listAllTokens(); len(tokens) == 1 && tokens[0].ID == vars["id"] {
+		w.WriteHeader(http.StatusConflict)
+		res := TokenResponse{"Cannot delete the last token.", newError(CodeConflict, fmt.Errorf("Create another token before deleting " + vars["id"] + ".")), Token{}, ""}
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	// Without an admin nobody could create tokens, change the config or manage templates again.
+	if admins := tokensWithRole(s.listAllTokens(), RoleAdmin); len(admins) == 1 && admins[0].ID == vars["id"] {
+		w.WriteHeader(http.StatusConflict)
+		res := TokenResponse{"Cannot delete the last admin token.", newError(CodeConflict, fmt.Errorf("Create another admin token before deleting " + vars["id"] + ".")), Token{}, ""}
+		log.WithFields(log.Fields{"error": res.Error}).Warn(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	err := s.deleteToken(vars["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		res := TokenResponse{"Token not found.", newError(CodeNotFound, err), Token{}, ""}
+		log.WithFields(log.Fields{"error": res.Error}).Info(res.Message)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	res := TokenResponse{"Token deleted.", nil, Token{ID: vars["id"]}, ""}
+	log.WithFields(log.Fields{"error": res.Error, "token": vars["id"], "deletedBy": requestToken(r).ID}).Info(res.Message)
+	json.NewEncoder(w).Encode(res)
+	return
+}
+
+func tokensWithRole(tokens []Token, role string) []Token {
+	var found []Token
+	for t := range tokens {
+		if tokens[t].Role == role {
+			found = append(found, tokens[t])
+		}
+	}
+	return found
+}
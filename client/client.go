@@ -0,0 +1,225 @@
+/*
+	Package client is a Go client for the Jest API. It sends and decodes the types of the
+	model package, which the api package serves too, so nothing has to be mirrored by hand
+	and the client only needs the standard library:
+
+		c := client.New("https://10.0.2.4", secret)
+		jUID, err := c.CreateJail(ctx, model.JailConfig{JailName: "mash", Hostname: "mash.local", IPV4Addr: "10.0.2.12", UseDefaults: true})
+
+	Every error response is returned as an *Error, and requests which are safe to repeat
+	are retried when the API can't be reached or is unavailable.
+*/
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/model"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	BaseURL    string // e.g. https://10.0.2.4
+	Token      string // The secret of the API token, sent as a bearer token
+	HTTPClient *http.Client
+	Retries    int           // How many times a GET, PUT or DELETE is retried
+	RetryWait  time.Duration // Doubled after every retry
+}
+
+const (
+	DefaultRetries   = 3
+	DefaultRetryWait = 500 * time.Millisecond
+)
+
+func New(baseURL string, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Token:      token,
+		HTTPClient: http.DefaultClient,
+		Retries:    DefaultRetries,
+		RetryWait:  DefaultRetryWait,
+	}
+}
+
+/*
+	An error response from the API. Message is the Message from the response envelope,
+	Code, Detail and Details are the Code, Message and Details of its Error.
+*/
+type Error struct {
+	StatusCode int
+	Code       string // One of the model package's Code constants, e.g. model.CodeIPInUse
+	Message    string
+	Detail     string
+	Details    map[string]string
+}
+
+func (e *Error) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("jest: %d %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("jest: %d %s %s", e.StatusCode, e.Message, e.Detail)
+}
+
+func statusIs(err error, code int) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == code
+}
+
+// Whether err is an error response with the code, e.g. model.CodeNameInUse.
+func HasCode(err error, code string) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == code
+}
+
+func IsNotFound(err error) bool {
+	return statusIs(err, http.StatusNotFound)
+}
+
+func IsConflict(err error) bool {
+	return statusIs(err, http.StatusConflict)
+}
+
+func IsUnauthorised(err error) bool {
+	return statusIs(err, http.StatusUnauthorized)
+}
+
+func IsForbidden(err error) bool {
+	return statusIs(err, http.StatusForbidden)
+}
+
+// The response envelope every endpoint returns, as far as errors are concerned.
+type envelope struct {
+	Message string
+	Error   json.RawMessage
+}
+
+func decodeError(status int, body []byte) error {
+	var env envelope
+	err := json.Unmarshal(body, &env)
+	if err != nil {
+		return &Error{StatusCode: status, Message: http.StatusText(status), Detail: strings.TrimSpace(string(body))}
+	}
+
+	e := &Error{StatusCode: status, Message: env.Message}
+
+	// Older versions of Jest sent the Error as a string, or as {} when it was lost.
+	var apiErr model.Error
+	var detail string
+	if json.Unmarshal(env.Error, &apiErr) == nil {
+		e.Code, e.Detail, e.Details = apiErr.Code, apiErr.Message, apiErr.Details
+	} else if json.Unmarshal(env.Error, &detail) == nil {
+		e.Detail = detail
+	}
+
+	return e
+}
+
+// Only requests which can safely be sent twice are retried.
+func retryable(method string, status int, err error) bool {
+	if method == http.MethodPost || method == http.MethodPatch {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func path(parts ...string) string {
+	for p := range parts {
+		parts[p] = url.PathEscape(parts[p])
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+/*
+	Send the request body as JSON and decode the response into out, which should be
+	the model package's response type for the endpoint. out can be nil. An error response
+	is decoded into out too, as some say more than their Error, like the Output of a
+	jail which failed to start.
+*/
+func (c *Client) do(ctx context.Context, method string, p string, in interface{}, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return err
+		}
+	}
+
+	wait := c.RetryWait
+	for attempt := 0; ; attempt++ {
+		status, resBody, err := c.send(ctx, method, p, body)
+		if attempt < c.Retries && retryable(method, status, err) {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+			wait *= 2
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if status >= 400 {
+			if out != nil {
+				json.Unmarshal(resBody, out)
+			}
+			return decodeError(status, resBody)
+		}
+
+		if out == nil {
+			return nil
+		}
+		return json.Unmarshal(resBody, out)
+	}
+}
+
+func (c *Client) send(ctx context.Context, method string, p string, body []byte) (int, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+p, reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return res.StatusCode, nil, err
+	}
+
+	return res.StatusCode, resBody, nil
+}
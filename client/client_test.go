@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/altsrc-io/Jest/model"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/*
+	A Client of a server which answers every request with the handler, and counts the
+	requests it gets. It doesn't wait long between retries.
+*/
+func testClient(handler http.HandlerFunc) (*Client, *int32, func()) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		handler(w, r)
+	}))
+
+	c := New(server.URL+"/", "secret")
+	c.RetryWait = time.Millisecond
+	return c, &requests, server.Close
+}
+
+func respond(w http.ResponseWriter, status int, body interface{}) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestJail(t *testing.T) {
+	want := model.Jail{Name: "mash", JailConfig: model.JailConfig{JailName: "mash", Hostname: "mash.local"}, JailState: model.JailState{Name: "mash", Running: true}, Owner: "alice"}
+	c, _, cleanup := testClient(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.EscapedPath() != "/jails/mash%20pie" {
+			t.Errorf("Request = %s %s, want GET /jails/mash%%20pie", r.Method, r.URL.EscapedPath())
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Errorf("Authorization = %q, want the token as a bearer token", auth)
+		}
+		respond(w, http.StatusOK, model.JailResponse{Message: "Jail found.", Jails: want})
+	})
+	defer cleanup()
+
+	got, err := c.Jail(context.Background(), "mash pie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(got, want) == false {
+		t.Errorf("Jail() = %+v, want %+v", got, want)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	tests := []struct {
+		body interface{}
+		want Error
+	}{
+		{
+			model.CreateJailResponse{Message: "IP address in use.", Error: &model.Error{Code: model.CodeIPInUse, Message: "IP address 10.0.2.12 is in use by pie.", Details: map[string]string{"Field": "IPV4Addr", "Jail": "pie"}}},
+			Error{StatusCode: http.StatusConflict, Code: model.CodeIPInUse, Message: "IP address in use.", Detail: "IP address 10.0.2.12 is in use by pie.", Details: map[string]string{"Field": "IPV4Addr", "Jail": "pie"}},
+		},
+		{
+			map[string]string{"Message": "IP address in use.", "Error": "IP address 10.0.2.12 is in use by pie."},
+			Error{StatusCode: http.StatusConflict, Message: "IP address in use.", Detail: "IP address 10.0.2.12 is in use by pie."},
+		},
+		{
+			"Bad Gateway",
+			Error{StatusCode: http.StatusConflict, Message: "Conflict", Detail: `"Bad Gateway"`},
+		},
+	}
+
+	for _, test := range tests {
+		body := test.body
+		c, _, cleanup := testClient(func(w http.ResponseWriter, r *http.Request) {
+			respond(w, http.StatusConflict, body)
+		})
+
+		_, err := c.CreateJail(context.Background(), model.JailConfig{JailName: "mash"})
+		cleanup()
+
+		got, ok := err.(*Error)
+		if ok == false {
+			t.Errorf("CreateJail() error = %#v, want an *Error", err)
+			continue
+		}
+		if reflect.DeepEqual(*got, test.want) == false {
+			t.Errorf("CreateJail() error = %+v, want %+v", *got, test.want)
+		}
+		if IsConflict(err) == false {
+			t.Errorf("IsConflict(%v) = false", err)
+		}
+		if HasCode(err, model.CodeIPInUse) != (test.want.Code == model.CodeIPInUse) {
+			t.Errorf("HasCode(%v, %s) = %t", err, model.CodeIPInUse, HasCode(err, model.CodeIPInUse))
+		}
+	}
+}
+
+func TestRetriesWhenUnavailable(t *testing.T) {
+	var failures int32 = 2
+	c, requests, cleanup := testClient(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			respond(w, http.StatusServiceUnavailable, model.ErrorResponse{Message: "Initialising.", Error: &model.Error{Code: model.CodeInitialising}})
+			return
+		}
+		respond(w, http.StatusOK, model.JailsResponse{Message: "Jails found.", Jails: []model.Jail{{Name: "mash"}}})
+	})
+	defer cleanup()
+
+	jails, err := c.Jails(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jails) != 1 || atomic.LoadInt32(requests) != 3 {
+		t.Errorf("Jails() = %+v after %d requests, want mash after 3", jails, atomic.LoadInt32(requests))
+	}
+}
+
+func TestGivesUpAfterRetries(t *testing.T) {
+	c, requests, cleanup := testClient(func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusServiceUnavailable, model.ErrorResponse{Message: "Initialising.", Error: &model.Error{Code: model.CodeInitialising}})
+	})
+	defer cleanup()
+	c.Retries = 2
+
+	start := time.Now()
+	_, err := c.Jails(context.Background())
+	if HasCode(err, model.CodeInitialising) == false {
+		t.Errorf("Jails() error = %v, want the last %s", err, model.CodeInitialising)
+	}
+	if got := atomic.LoadInt32(requests); got != 3 {
+		t.Errorf("Jails() sent %d requests, want the first and 2 retries", got)
+	}
+	// The wait doubles, 1ms then 2ms.
+	if elapsed := time.Since(start); elapsed < 3*time.Millisecond {
+		t.Errorf("Jails() gave up after %s, want at least 3ms of waiting", elapsed)
+	}
+}
+
+func TestPostIsntRetried(t *testing.T) {
+	c, requests, cleanup := testClient(func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusServiceUnavailable, model.ErrorResponse{Message: "Initialising.", Error: &model.Error{Code: model.CodeInitialising}})
+	})
+	defer cleanup()
+
+	_, err := c.CreateJail(context.Background(), model.JailConfig{JailName: "mash"})
+	if HasCode(err, model.CodeInitialising) == false {
+		t.Errorf("CreateJail() error = %v, want %s", err, model.CodeInitialising)
+	}
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("CreateJail() sent %d requests, want a POST to be sent once", got)
+	}
+}
+
+func TestRetryStopsWhenCancelled(t *testing.T) {
+	c, requests, cleanup := testClient(func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusServiceUnavailable, model.ErrorResponse{Message: "Initialising."})
+	})
+	defer cleanup()
+	c.RetryWait = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := c.Jails(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Jails() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("Jails() sent %d requests, want 1 before the context ran out", got)
+	}
+}
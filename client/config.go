@@ -0,0 +1,31 @@
+package client
+
+import (
+	"context"
+	"github.com/altsrc-io/Jest/model"
+)
+
+func (c *Client) Config(ctx context.Context) (model.Config, error) {
+	var res model.ConfigResponse
+	err := c.do(ctx, "GET", "/config", nil, &res)
+	return res.Config, err
+}
+
+// Every version of the config, oldest first.
+func (c *Client) ConfigHistory(ctx context.Context) ([]model.Config, error) {
+	var res model.ConfigResponse
+	err := c.do(ctx, "GET", "/config", nil, &res)
+	return res.History, err
+}
+
+func (c *Client) UpdateConfig(ctx context.Context, form model.ConfigUpdate) (model.Config, error) {
+	var res model.ConfigResponse
+	err := c.do(ctx, "PUT", "/config", form, &res)
+	return res.Config, err
+}
+
+func (c *Client) RollbackConfig(ctx context.Context, version int) (model.Config, error) {
+	var res model.ConfigResponse
+	err := c.do(ctx, "POST", "/config", model.ConfigRollback{Version: version}, &res)
+	return res.Config, err
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/model"
+	"time"
+)
+
+// The datasets Jest has been initialised in, the API's 404 for a host which hasn't been is an empty list.
+func (c *Client) InitStatus(ctx context.Context) ([]model.Dataset, error) {
+	var res model.InitResponse
+	err := c.do(ctx, "GET", "/init", nil, &res)
+	if IsNotFound(err) {
+		return []model.Dataset{}, nil
+	}
+	return res.Datasets, err
+}
+
+/*
+	Start initialising the host, returning the init job. Wait for the job to finish
+	with WaitJob, its Result is a model.InitResponse with the first template's root password.
+*/
+func (c *Client) Init(ctx context.Context, form model.InitCreate) (*model.Job, error) {
+	var res model.JobResponse
+	err := c.do(ctx, "POST", "/init", form, &res)
+	return res.Job, err
+}
+
+// Stop every jail and destroy every dataset Jest created, or only list them if dryRun is set.
+func (c *Client) Deinit(ctx context.Context, dryRun bool) (model.DeleteInitResponse, error) {
+	var res model.DeleteInitResponse
+	err := c.do(ctx, "DELETE", "/init", model.InitDelete{DryRun: dryRun}, &res)
+	return res, err
+}
+
+func (c *Client) Jobs(ctx context.Context) ([]*model.Job, error) {
+	var res model.JobsResponse
+	err := c.do(ctx, "GET", "/jobs", nil, &res)
+	return res.Jobs, err
+}
+
+func (c *Client) Job(ctx context.Context, id string) (*model.Job, error) {
+	var res model.JobResponse
+	err := c.do(ctx, "GET", path("jobs", id), nil, &res)
+	return res.Job, err
+}
+
+func (c *Client) CancelJob(ctx context.Context, id string) (*model.Job, error) {
+	var res model.JobResponse
+	err := c.do(ctx, "DELETE", path("jobs", id), nil, &res)
+	return res.Job, err
+}
+
+/*
+	Poll the job every interval until it finishes or the context is done. A job which
+	fails or is cancelled is returned along with an error saying why.
+*/
+func (c *Client) WaitJob(ctx context.Context, id string, interval time.Duration) (*model.Job, error) {
+	for {
+		j, err := c.Job(ctx, id)
+		if err != nil {
+			return j, err
+		}
+
+		switch j.Status {
+		case model.JobSucceeded:
+			return j, nil
+		case model.JobFailed, model.JobCancelled:
+			return j, fmt.Errorf("The job %s %s: %s", j.ID, j.Status, j.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return j, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Decode the Result of a finished job, e.g. into a model.InitResponse.
+func DecodeResult(j *model.Job, v interface{}) error {
+	encoded, err := json.Marshal(j.Result)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, v)
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"github.com/altsrc-io/Jest/model"
+)
+
+// Every jail on the host, the API's 404 for a host without jails is an empty list.
+func (c *Client) Jails(ctx context.Context) ([]model.Jail, error) {
+	var res model.JailsResponse
+	err := c.do(ctx, "GET", "/jails", nil, &res)
+	if IsNotFound(err) {
+		return []model.Jail{}, nil
+	}
+	return res.Jails, err
+}
+
+func (c *Client) Jail(ctx context.Context, name string) (model.Jail, error) {
+	var res model.JailResponse
+	err := c.do(ctx, "GET", path("jails", name), nil, &res)
+	return res.Jails, err
+}
+
+// Create the jail, returning its UUID. The template defaults to the config's DefaultTemplate.
+func (c *Client) CreateJail(ctx context.Context, form model.JailConfig) (string, error) {
+	var res model.CreateJailResponse
+	err := c.do(ctx, "POST", "/jails", form, &res)
+	return res.JUID, err
+}
+
+func (c *Client) StartJail(ctx context.Context, name string) (model.JailState, error) {
+	res, err := c.RunJailAction(ctx, name, "start", model.JailAction{})
+	return res.JailState, err
+}
+
+// Stop the jail, removing it with jail -R if its exec.stop fails.
+func (c *Client) StopJail(ctx context.Context, name string) (model.JailState, error) {
+	res, err := c.RunJailAction(ctx, name, "stop", model.JailAction{Force: true})
+	return res.JailState, err
+}
+
+func (c *Client) RestartJail(ctx context.Context, name string) (model.JailState, error) {
+	res, err := c.RunJailAction(ctx, name, "restart", model.JailAction{Force: true})
+	return res.JailState, err
+}
+
+/*
+	Start, stop or restart the jail. The response has what exec.start and exec.stop
+	printed, and is returned with the error if the action fails. With Dependencies set
+	in the form, the jails it depends on, or which depend on it, are included in order.
+*/
+func (c *Client) RunJailAction(ctx context.Context, name string, action string, form model.JailAction) (model.JailActionResponse, error) {
+	var res model.JailActionResponse
+	err := c.do(ctx, "POST", path("jails", name, action), form, &res)
+	return res, err
+}
+
+/*
+	Change the fields of the jail's config which the update sets. With apply, a running
+	jail has what can be changed applied straight away, the response says whether it
+	still has to be restarted.
+*/
+func (c *Client) UpdateJail(ctx context.Context, name string, update model.JailConfigUpdate, apply bool) (model.JailUpdateResponse, error) {
+	var res model.JailUpdateResponse
+	err := c.do(ctx, "PATCH", path("jails", name), model.JailUpdate{JailConfigUpdate: update, Apply: apply}, &res)
+	return res, err
+}
+
+// Stop and delete the jail, the jail's snapshots are only destroyed if destroySnapshots is set.
+func (c *Client) DeleteJail(ctx context.Context, name string, destroySnapshots bool) error {
+	return c.do(ctx, "DELETE", path("jails", name), model.JailDelete{DestroySnapshots: destroySnapshots}, nil)
+}
+
+// The names of the jails in each group.
+func (c *Client) Groups(ctx context.Context) (map[string][]string, error) {
+	var res model.GroupsResponse
+	err := c.do(ctx, "GET", "/groups", nil, &res)
+	return res.Groups, err
+}
+
+/*
+	Start, stop or restart every jail in the group in dependency order. The response has
+	a Step for each jail, and is returned with the error if any of them failed.
+*/
+func (c *Client) RunGroupAction(ctx context.Context, group string, action string, form model.JailAction) (model.GroupActionResponse, error) {
+	var res model.GroupActionResponse
+	err := c.do(ctx, "POST", path("groups", group, action), form, &res)
+	return res, err
+}
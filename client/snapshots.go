@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"github.com/altsrc-io/Jest/model"
+)
+
+func (c *Client) Snapshots(ctx context.Context) ([]model.Snapshot, error) {
+	var res model.SnapshotsResponse
+	err := c.do(ctx, "GET", "/snapshots", nil, &res)
+	if IsNotFound(err) {
+		return []model.Snapshot{}, nil
+	}
+	return res.Snapshots, err
+}
+
+func (c *Client) Snapshot(ctx context.Context, name string) (model.Snapshot, error) {
+	var res model.SnapshotResponse
+	err := c.do(ctx, "GET", path("snapshots", name), nil, &res)
+	return res.Snapshot, err
+}
+
+// Snapshot a jail as <jail>@<snapshot>, or a template as .<template>@<snapshot>.
+func (c *Client) CreateSnapshot(ctx context.Context, name string) (model.Snapshot, error) {
+	var res model.SnapshotResponse
+	err := c.do(ctx, "POST", "/snapshots", model.SnapshotCreate{Name: name}, &res)
+	return res.Snapshot, err
+}
+
+func (c *Client) RollbackSnapshot(ctx context.Context, name string, destroyMoreRecent bool) (model.Snapshot, error) {
+	var res model.SnapshotResponse
+	err := c.do(ctx, "PUT", path("snapshots", name), model.SnapshotRollback{DestroyMoreRecent: destroyMoreRecent}, &res)
+	return res.Snapshot, err
+}
+
+func (c *Client) DeleteSnapshot(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", path("snapshots", name), nil, nil)
+}
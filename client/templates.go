@@ -0,0 +1,42 @@
+package client
+
+import (
+	"context"
+	"github.com/altsrc-io/Jest/model"
+)
+
+func (c *Client) Templates(ctx context.Context) ([]model.Template, error) {
+	var res model.TemplatesResponse
+	err := c.do(ctx, "GET", "/templates", nil, &res)
+	if IsNotFound(err) {
+		return []model.Template{}, nil
+	}
+	return res.Templates, err
+}
+
+func (c *Client) Template(ctx context.Context, name string) (model.Template, error) {
+	var res model.TemplateResponse
+	err := c.do(ctx, "GET", path("templates", name), nil, &res)
+	return res.Template, err
+}
+
+/*
+	Start creating the template, returning the job creating it. Wait for the job to
+	finish with WaitJob, its Result is a model.CreateTemplateResponse.
+*/
+func (c *Client) CreateTemplate(ctx context.Context, params model.FreeBSDParams) (*model.Job, error) {
+	var res model.JobResponse
+	err := c.do(ctx, "POST", "/templates", params, &res)
+	return res.Job, err
+}
+
+// Disabled templates are kept, but can't be used to create new jails.
+func (c *Client) SetTemplateDisabled(ctx context.Context, name string, disabled bool) (model.Template, error) {
+	var res model.TemplateResponse
+	err := c.do(ctx, "PUT", path("templates", name), model.TemplateUpdate{Disabled: disabled}, &res)
+	return res.Template, err
+}
+
+func (c *Client) DeleteTemplate(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", path("templates", name), nil, nil)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"github.com/altsrc-io/Jest/api"
+	"github.com/altsrc-io/Jest/command"
+	"github.com/altsrc-io/Jest/host"
+	"github.com/altsrc-io/Jest/jail"
+	"github.com/altsrc-io/Jest/zfs"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"os"
+)
+
+/*
+	jest serves the API. jest boot starts the jails flagged StartAtBoot and exits, it's
+	run by the jest_boot rc.d script when the host starts.
+*/
+func main() {
+	args := os.Args[1:]
+	boot := len(args) > 0 && args[0] == "boot"
+	if boot {
+		args = args[1:]
+	}
+
+	opts, err := api.ParseOptions(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	api.ConfigureLogging(opts)
+
+	var runner command.Runner = command.ExecRunner{}
+	if opts.IsDryRun() {
+		log.Warn("Dry run - commands will be logged but not executed.")
+		runner = command.DryRunRunner{}
+	}
+
+	if boot {
+		os.Exit(runBoot(opts, runner))
+	}
+
+	s, err := api.NewServer(opts, zfs.GoZFSStorage{Runner: runner}, runner, os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+
+	printBanner(s.ListenAddr(), s.Conf.TLS.Disabled == false)
+	log.Fatal(s.ListenAndServe())
+}
+
+func runBoot(opts api.Options, runner command.Runner) int {
+	h := host.New(zfs.GoZFSStorage{Runner: runner}, runner)
+	h.Dataset = opts.Dataset
+
+	err := h.Load()
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	defer h.Close()
+
+	if h.IsInitialised == false {
+		log.Info("The host isn't initialised, there are no jails to start.")
+		return 0
+	}
+
+	err = jail.Boot(h)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	log.Info("Started the jails.")
+	return 0
+}
+
+func printBanner(listenAddr string, tls bool) {
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+
+	hostname, port, err := net.SplitHostPort(listenAddr)
+	if err != nil || hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	fmt.Println("\nJest version", api.Version, "- "+scheme+"://"+net.JoinHostPort(hostname, port))
+	fmt.Println("Get enterprise support at: https://www.AltSrc.com/jest")
+	fmt.Println()
+}
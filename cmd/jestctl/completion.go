@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/altsrc-io/Jest/client"
+	"io"
+	"strings"
+)
+
+/*
+	The completion scripts complete the groups and commands, and the names of jails,
+	jail groups, templates and snapshots, which they get from the hidden __names commands.
+*/
+const bashCompletion = `# jestctl bash completion, load it with: source <(jestctl completion bash)
+_jestctl() {
+	local cur=${COMP_WORDS[COMP_CWORD]}
+	local words=() w
+	for w in "${COMP_WORDS[@]:1:COMP_CWORD-1}"; do
+		case $w in
+			-*) ;;
+			*) words+=("$w") ;;
+		esac
+	done
+
+	case ${#words[@]} in
+		0) COMPREPLY=($(compgen -W "%s completion" -- "$cur")) ;;
+		1) case ${words[0]} in
+%s			completion) COMPREPLY=($(compgen -W "bash zsh" -- "$cur")) ;;
+		esac ;;
+		*) case ${words[0]} in
+			jail|group|snapshot|template) COMPREPLY=($(compgen -W "$(jestctl __names ${words[0]} 2>/dev/null)" -- "$cur")) ;;
+		esac ;;
+	esac
+}
+complete -F _jestctl jestctl
+`
+
+const zshCompletion = `# jestctl zsh completion, load it with: source <(jestctl completion zsh)
+autoload -U +X bashcompinit && bashcompinit
+`
+
+func runCompletion(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) != 1 || (args[0] != "bash" && args[0] != "zsh") {
+		fmt.Fprintln(stderr, "Usage: jestctl completion bash|zsh")
+		return 2
+	}
+
+	var cases string
+	for _, group := range groups() {
+		cases += fmt.Sprintf("\t\t\t%s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", group, strings.Join(sortedKeys(commands[group]), " "))
+	}
+	script := fmt.Sprintf(bashCompletion, strings.Join(groups(), " "), cases)
+
+	if args[0] == "zsh" {
+		script = zshCompletion + strings.SplitN(script, "\n", 2)[1]
+	}
+
+	fmt.Fprint(stdout, script)
+	return 0
+}
+
+/*
+	The hidden __names commands print the names of the jails, groups, templates or snapshots,
+	one per line, for the completion scripts.
+*/
+func init() {
+	register("__names", "jail", &command{
+		run: func(ctx context.Context, c *client.Client, out *output, args []string) error {
+			jails, err := c.Jails(ctx)
+			for _, j := range jails {
+				fmt.Fprintln(out.w, j.Name)
+			}
+			return err
+		},
+	})
+
+	register("__names", "group", &command{
+		run: func(ctx context.Context, c *client.Client, out *output, args []string) error {
+			groups, err := c.Groups(ctx)
+			for _, name := range sortedGroups(groups) {
+				fmt.Fprintln(out.w, name)
+			}
+			return err
+		},
+	})
+
+	register("__names", "template", &command{
+		run: func(ctx context.Context, c *client.Client, out *output, args []string) error {
+			templates, err := c.Templates(ctx)
+			for _, t := range templates {
+				fmt.Fprintln(out.w, t.Name)
+			}
+			return err
+		},
+	})
+
+	register("__names", "snapshot", &command{
+		run: func(ctx context.Context, c *client.Client, out *output, args []string) error {
+			snapshots, err := c.Snapshots(ctx)
+			for _, s := range snapshots {
+				fmt.Fprintln(out.w, s.Name)
+			}
+			return err
+		},
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/altsrc-io/Jest/client"
+	"github.com/altsrc-io/Jest/model"
+	"sort"
+	"strings"
+)
+
+func sortedGroups(groups map[string][]string) []string {
+	var names []string
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	list := &command{
+		help: "List the groups and their jails",
+		run: func(ctx context.Context, c *client.Client, out *output, args []string) error {
+			groups, err := c.Groups(ctx)
+			if err != nil {
+				return err
+			}
+
+			return out.print(groups, []string{"GROUP", "JAILS"}, func() [][]string {
+				var rows [][]string
+				for _, name := range sortedGroups(groups) {
+					rows = append(rows, []string{name, strings.Join(groups[name], ",")})
+				}
+				return rows
+			})
+		},
+	}
+	register("group", "ls", list)
+	register("group", "list", list)
+
+	for _, action := range []string{"start", "stop", "restart"} {
+		registerGroupAction(action)
+	}
+}
+
+/*
+	group start, stop and restart act on every jail in the group in dependency order,
+	and print what happened to each of them.
+*/
+func registerGroupAction(action string) {
+	var form model.JailAction
+	cmd := &command{
+		usage: "<group>",
+		help:  strings.Title(action) + " the jails in a group, in dependency order",
+		run: func(ctx context.Context, c *client.Client, out *output, args []string) error {
+			group, err := oneName(args, "group")
+			if err != nil {
+				return err
+			}
+
+			res, err := c.RunGroupAction(ctx, group, action, form)
+			if err != nil {
+				if len(res.Steps) > 0 {
+					printSteps(out, res.Steps)
+				}
+				return err
+			}
+			return printSteps(out, res.Steps)
+		},
+	}
+
+	if action != "start" {
+		cmd.flags = func(fs *flag.FlagSet) {
+			stopFlags(fs, &form)
+		}
+	}
+
+	register("group", action, cmd)
+}
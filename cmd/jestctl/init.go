@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/altsrc-io/Jest/client"
+)
+
+func init() {
+	register("init", "status", &command{
+		help: "Show the datasets Jest has been initialised in",
+		run: func(ctx context.Context, c *client.Client, out *output, args []string) error {
+			datasets, err := c.InitStatus(ctx)
+			if err != nil {
+				return err
+			}
+
+			if len(datasets) == 0 && out.format == "table" {
+				return out.message(datasets, "This host hasn't been initialised.")
+			}
+
+			return out.print(datasets, []string{"DATASET", "MOUNTPOINT", "COMPRESSION", "USED"}, func() [][]string {
+				var rows [][]string
+				for _, d := range datasets {
+					rows = append(rows, []string{d.Name, d.Mountpoint, d.Compression, fmt.Sprint(d.Used)})
+				}
+				return rows
+			})
+		},
+	})
+}
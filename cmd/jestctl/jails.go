@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/altsrc-io/Jest/client"
+	"github.com/altsrc-io/Jest/model"
+	"strconv"
+	"strings"
+)
+
+var jailHeader = []string{"NAME", "RUNNING", "JID", "HOSTNAME", "IP", "TEMPLATE", "OWNER"}
+
+func jailRow(j model.Jail) []string {
+	ips := strings.Join(append(j.JailState.IPV4Addrs, j.JailState.IPV6Addrs...), ",")
+	if ips == "" {
+		ips = strings.Trim(j.JailConfig.IPV4Addr+","+j.JailConfig.IPV6Addr, ",")
+	}
+
+	return []string{
+		j.Name,
+		yesNo(j.JailState.Running),
+		orDash(j.JailState.JID),
+		j.JailConfig.Hostname,
+		ips,
+		j.JailConfig.Template,
+		orDash(j.Owner),
+	}
+}
+
+func stateRow(s model.JailState) []string {
+	return []string{s.Name, yesNo(s.Running), orDash(s.JID), orDash(s.Hostname), strings.Join(append(s.IPV4Addrs, s.IPV6Addrs...), ",")}
+}
+
+var stateHeader = []string{"NAME", "RUNNING", "JID", "HOSTNAME", "IP"}
+
+// A string flag which is only set if it's given, so it can be set to "".
+type optionalString struct {
+	p **string
+}
+
+func (o optionalString) String() string {
+	if o.p == nil || *o.p == nil {
+		return ""
+	}
+	return **o.p
+}
+
+func (o optionalString) Set(value string) error {
+	*o.p = &value
+	return nil
+}
+
+// A comma separated list of names.
+type listFlag struct {
+	p *[]string
+}
+
+func (l listFlag) String() string {
+	if l.p == nil {
+		return ""
+	}
+	return strings.Join(*l.p, ",")
+}
+
+func (l listFlag) Set(value string) error {
+	*l.p = splitList(value)
+	return nil
+}
+
+type optionalBool struct {
+	p **bool
+}
+
+func (o optionalBool) String() string {
+	if o.p == nil || *o.p == nil {
+		return ""
+	}
+	return strconv.FormatBool(**o.p)
+}
+
+func (o optionalBool) Set(value string) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*o.p = &b
+	return nil
+}
+
+// Lets -flag be given without a value, like a flag.Bool.
+func (o optionalBool) IsBoolFlag() bool {
+	return true
+}
+
+type optionalInt struct {
+	p **int
+}
+
+func (o optionalInt) String() string {
+	if o.p == nil || *o.p == nil {
+		return ""
+	}
+	return strconv.Itoa(**o.p)
+}
+
+func (o optionalInt) Set(value string) error {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*o.p = &i
+	return nil
+}
+
+// A comma separated list, "" sets it to an empty list.
+type optionalList struct {
+	p **[]string
+}
+
+func (o optionalList) String() string {
+	if o.p == nil || *o.p == nil {
+		return ""
+	}
+	return strings.Join(**o.p, ",")
+}
+
+func (o optionalList) Set(value string) error {
+	list := splitList(value)
+	*o.p = &list
+	return nil
+}
+
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func init() {
+	list := &command{
+		help: "List the jails",
+		run: func(ctx context.Context, c *client.Client, out *output, args []string) error {
+			jails, err := c.Jails(ctx)
+			if err != nil {
+				return err
+			}
+
+			return out.print(jails, jailHeader, func() [][]string {
+				var rows [][]string
+				for _, j := range jails {
+					rows = append(rows, jailRow(j))
+				}
+				return rows
+			})
+		},
+	}
+	register("jail", "list", list)
+	register("jail", "ls", list)
+
+	register("jail", "show", &command{
+		usage: "<name>",
+		help:  "Show a jail and its config",
+		run: func(ctx context.Context, c *client.Client, out *output, args []string) error {
+			name, err := oneName(args, "jail")
+			if err != nil {
+				return err
+			}
+
+			j, err := c.Jail(ctx, name)
+			if err != nil {
+				return err
+			}
+
+			return out.print(j, []string{"FIELD", "VALUE"}, func() [][]string {
+				conf := j.JailConfig
+				return [][]string{
+					{"Name", j.Name},
+					{"Owner", orDash(j.Owner)},
+					{"Running", yesNo(j.JailState.Running)},
+					{"JID", orDash(j.JailState.JID)},
+					{"Template", conf.Template},
+					{"Hostname", conf.Hostname},
+					{"Interface", orDash(conf.Interface)},
+					{"IPV4Addr", orDash(conf.IPV4Addr)},
+					{"IPV4Mode", orDash(conf.IPV4Mode)},
+					{"IPV6Addr", orDash(conf.IPV6Addr)},
+					{"IPV6Mode", orDash(conf.IPV6Mode)},
+					{"Path", orDash(conf.Path)},
+					{"ConsoleLog", orDash(conf.ConsoleLog)},
+					{"JailUser", orDash(conf.JailUser)},
+					{"SystemUser", orDash(conf.SystemUser)},
+					{"Start", orDash(conf.Start)},
+					{"Stop", orDash(conf.Stop)},
+					{"StopTimeout", orDash(conf.StopTimeout)},
+					{"StartAtBoot", yesNo(conf.StartAtBoot)},
+					{"BootPriority", strconv.Itoa(conf.BootPriority)},
+					{"Depends", orDash(strings.Join(conf.Depends, ","))},
+					{"Groups", orDash(strings.Join(conf.Groups, ","))},
+					{"AllowRawSockets", orDash(conf.AllowRawSockets)},
+					{"AllowMount", orDash(conf.AllowMount)},
+					{"AllowSetHostname", orDash(conf.AllowSetHostname)},
+					{"AllowSysVIPC", orDash(conf.AllowSysVIPC)},
+					{"Clean", orDash(conf.Clean)},
+				}
+			})
+		},
+	})
+
+	var form model.JailConfig
+	register("jail", "create", &command{
+		usage: "<name>",
+		help:  "Create a jail from a template",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&form.Hostname, "hostname", "", "The jail's hostname.")
+			fs.StringVar(&form.IPV4Addr, "ip", "", "The jail's IPv4 addresses, separated by commas, each optionally interface|address/prefix.")
+			fs.StringVar(&form.IPV6Addr, "ip6", "", "The jail's IPv6 addresses, as for -ip.")
+			fs.StringVar(&form.Interface, "interface", "", "The interface to add addresses without one to.")
+			fs.StringVar(&form.IPV4Mode, "ip4-mode", "", "new, inherit or disable.")
+			fs.StringVar(&form.IPV6Mode, "ip6-mode", "", "new, inherit or disable.")
+			fs.StringVar(&form.Template, "template", "", "The template to clone (default the config's DefaultTemplate).")
+			fs.BoolVar(&form.UseDefaults, "defaults", true, "Use the config's JailDefaults for everything else.")
+			fs.BoolVar(&form.StartAtBoot, "boot", false, "Start the jail when the host starts.")
+			fs.IntVar(&form.BootPriority, "boot-priority", 0, "Jails with a lower priority are started first.")
+			fs.Var(listFlag{&form.Depends}, "depends", "The jails to start before this one, separated by commas.")
+			fs.Var(listFlag{&form.Groups}, "groups", "The groups the jail is in, separated by commas.")
+		},
+		run: func(ctx context.Context, c *client.Client, out *output, args []string) error {
+			name, err := oneName(args, "jail")
+			if err != nil {
+				return err
+			}
+			form.JailName = name
+
+			jUID, err := c.CreateJail(ctx, form)
+			if err != nil {
+				return err
+			}
+
+			return out.message(map[string]string{"Name": name, "JUID": jUID}, "Created the jail "+name+" ("+jUID+").")
+		},
+	})
+
+	for _, action := range []string{"start", "stop", "restart"} {
+		registerJailAction(action)
+	}
+
+	var update model.JailConfigUpdate
+	var apply bool
+	register("jail", "update", &command{
+		usage: "<name>",
+		help:  "Change a jail's config",
+		flags: func(fs *flag.FlagSet) {
+			fs.Var(optionalString{&update.Hostname}, "hostname", "The jail's hostname.")
+			fs.Var(optionalString{&update.IPV4Addr}, "ip", "The jail's IPv4 addresses, separated by commas, each optionally interface|address/prefix.")
+			fs.Var(optionalString{&update.IPV6Addr}, "ip6", "The jail's IPv6 addresses, as for -ip.")
+			fs.Var(optionalString{&update.Interface}, "interface", "The interface to add addresses without one to.")
+			fs.Var(optionalString{&update.IPV4Mode}, "ip4-mode", "new, inherit or disable.")
+			fs.Var(optionalString{&update.IPV6Mode}, "ip6-mode", "new, inherit or disable.")
+			fs.Var(optionalString{&update.Start}, "exec-start", "The command run in the jail when it starts.")
+			fs.Var(optionalString{&update.Stop}, "exec-stop", "The command run in the jail when it stops.")
+			fs.Var(optionalString{&update.StopTimeout}, "stop-timeout", "Seconds the jail gets to stop before it's treated as failed.")
+			fs.Var(optionalBool{&update.StartAtBoot}, "boot", "Start the jail when the host starts.")
+			fs.Var(optionalInt{&update.BootPriority}, "boot-priority", "Jails with a lower priority are started first.")
+			fs.Var(optionalList{&update.Depends}, "depends", "The jails to start before this one, separated by commas.")
+			fs.Var(optionalList{&update.Groups}, "groups", "The groups the jail is in, separated by commas.")
+			fs.Var(optionalString{&update.AllowRawSockets}, "allow-raw-sockets", "1 to allow raw sockets, 0 not to.")
+			fs.Var(optionalString{&update.AllowMount}, "allow-mount", "1 to allow mounting filesystems, 0 not to.")
+			fs.Var(optionalString{&update.AllowSetHostname}, "allow-set-hostname", "1 to let the jail change its hostname, 0 not to.")
+			fs.Var(optionalString{&update.AllowSysVIPC}, "allow-sysvipc", "1 to allow System V IPC, 0 not to.")
+			fs.Var(optionalString{&update.ConsoleLog}, "console-log", "The file the jail's console output is written to.")
+			fs.BoolVar(&apply, "apply", false, "Apply what can be changed to the running jail straight away.")
+		},
+		run: func(ctx context.Context, c *client.Client, out *output, args []string) error {
+			name, err := oneName(args, "jail")
+			if err != nil {
+				return err
+			}
+
+			res, err := c.UpdateJail(ctx, name, update, apply)
+			if err != nil {
+				return err
+			}
+
+			message := "Updated the jail " + name + ", changed: " + orDash(strings.Join(res.Changed, ", ")) + "."
+			if len(res.Applied) > 0 {
+				message += " Applied to the running jail: " + strings.Join(res.Applied, ", ") + "."
+			}
+			if res.RestartRequired {
+				message += " Restart the jail for the rest to take effect."
+			}
+			return out.message(res, message)
+		},
+	})
+
+	var destroySnapshots bool
+	register("jail", "rm", &command{
+		usage: "<name>",
+		help:  "Stop and delete a jail",
+		flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&destroySnapshots, "destroy-snapshots", false, "Destroy the jail's snapshots too.")
+		},
+		run: func(ctx context.Context, c *client.Client, out *output, args []string) error {
+			name, err := oneName(args, "jail")
+			if err != nil {
+				return err
+			}
+
+			err = c.DeleteJail(ctx, name, destroySnapshots)
+			if err != nil {
+				return err
+			}
+
+			return out.message(map[string]string{"Name": name}, "Deleted the jail "+name+".")
+		},
+	})
+}
+
+/*
+	jail start, stop and restart print the jail's state, then whatever exec.start and
+	exec.stop printed, which is printed when they fail too.
+*/
+func registerJailAction(action string) {
+	var form model.JailAction
+	cmd := &command{
+		usage: "<name>",
+		help:  strings.Title(action) + " a jail",
+		run: func(ctx context.Context, c *client.Client, out *output, args []string) error {
+			name, err := oneName(args, "jail")
+			if err != nil {
+				return err
+			}
+
+			res, err := c.RunJailAction(ctx, name, action, form)
+			if err != nil {
+				if len(res.Steps) > 0 {
+					printSteps(out, res.Steps)
+				} else {
+					printJailOutput(out, res.Output)
+				}
+				return err
+			}
+
+			if out.format == "json" {
+				return out.print(res, nil, nil)
+			}
+			if len(res.Steps) > 0 {
+				return printSteps(out, res.Steps)
+			}
+			err = out.print(res.JailState, stateHeader, func() [][]string { return [][]string{stateRow(res.JailState)} })
+			if err != nil {
+				return err
+			}
+			if res.Output.Forced {
+				fmt.Fprintln(out.w, "\nexec.stop failed, so the jail was removed with jail -R.")
+			}
+			printJailOutput(out, res.Output)
+			return nil
+		},
+	}
+
+	cmd.flags = func(fs *flag.FlagSet) {
+		if action == "start" {
+			fs.BoolVar(&form.Dependencies, "deps", false, "Start the jails it depends on first.")
+			return
+		}
+		fs.BoolVar(&form.Dependencies, "deps", false, "Stop the jails which depend on it first.")
+		stopFlags(fs, &form)
+	}
+
+	register("jail", action, cmd)
+}
+
+func stopFlags(fs *flag.FlagSet, form *model.JailAction) {
+	fs.IntVar(&form.StopTimeout, "timeout", 0, "Seconds exec.stop gets to finish, instead of the jail's StopTimeout.")
+	fs.BoolVar(&form.Force, "force", true, "Remove the jail with jail -R if exec.stop fails or times out.")
+}
+
+var stepHeader = []string{"NAME", "ACTION", "RUNNING", "RESULT"}
+
+/*
+	Print what happened to each jail started or stopped in order, followed by what the
+	ones which failed printed.
+*/
+func printSteps(out *output, steps []model.JailStep) error {
+	err := out.print(steps, stepHeader, func() [][]string {
+		var rows [][]string
+		for _, step := range steps {
+			result := "ok"
+			switch {
+			case step.Skipped:
+				result = "skipped"
+			case step.Error != "":
+				result = step.Error
+			case step.Output.Forced:
+				result = "removed with jail -R"
+			}
+			rows = append(rows, []string{step.Name, orDash(step.Action), yesNo(step.State.Running), result})
+		}
+		return rows
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, step := range steps {
+		if step.Error != "" && out.format != "json" {
+			fmt.Fprintf(out.w, "\n=== %s ===\n", step.Name)
+			printJailOutput(out, step.Output)
+		}
+	}
+	return nil
+}
+
+func printJailOutput(out *output, o model.JailOutput) {
+	if out.format == "json" {
+		return
+	}
+
+	sections := []struct {
+		name string
+		text string
+	}{
+		{"stdout", o.Stdout},
+		{"stderr", o.Stderr},
+		{"console log", o.ConsoleLog},
+	}
+	for s := range sections {
+		text := strings.TrimRight(sections[s].text, "\n")
+		if text == "" {
+			continue
+		}
+		fmt.Fprintf(out.w, "\n--- %s ---\n%s\n", sections[s].name, text)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+	jestctl is a command line client for the Jest API:
+
+		jestctl jail create -hostname mash.local -ip 10.0.2.12 mash
+		jestctl jail start mash
+		jestctl -o json jail list
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/altsrc-io/Jest/client"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+/*
+	A command, run as jestctl <group> <name>. Its flags are parsed before run is
+	called, and run gets the arguments left after them.
+*/
+type command struct {
+	usage string // The arguments, shown after the command name
+	help  string
+	flags func(fs *flag.FlagSet)
+	run   func(ctx context.Context, c *client.Client, out *output, args []string) error
+}
+
+// Filled in by the files which define the commands.
+var commands = map[string]map[string]*command{}
+
+func register(group string, name string, cmd *command) {
+	if commands[group] == nil {
+		commands[group] = make(map[string]*command)
+	}
+	commands[group][name] = cmd
+}
+
+func sortedKeys(m map[string]*command) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// The groups of commands, leaving out the hidden ones which start with __.
+func groups() []string {
+	var keys []string
+	for k := range commands {
+		if strings.HasPrefix(k, "__") == false {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: jestctl [-server address] [-token secret] [-o table|json] <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, group := range groups() {
+		for _, name := range sortedKeys(commands[group]) {
+			cmd := commands[group][name]
+			fmt.Fprintf(w, "  %-40s %s\n", strings.TrimSpace(group+" "+name+" "+cmd.usage), cmd.help)
+		}
+	}
+	fmt.Fprintln(w, "  completion bash|zsh                      Print the shell completion script")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "The server and token can also be set in ~/.jestctl.json, e.g. {\"Server\": \"https://10.0.2.4\", \"Token\": \"3f1c...9a0e\"}")
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// Run jestctl, returning the exit status: 1 if the command failed and 2 if it wasn't understood.
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	settings, args, err := ParseSettings(args)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	if len(args) > 0 && args[0] == "completion" {
+		return runCompletion(args[1:], stdout, stderr)
+	}
+
+	if len(args) < 2 || commands[args[0]] == nil || commands[args[0]][args[1]] == nil {
+		usage(stderr)
+		return 2
+	}
+	cmd := commands[args[0]][args[1]]
+
+	out := &output{w: stdout, format: settings.Output}
+	fs := flag.NewFlagSet("jestctl "+args[0]+" "+args[1], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: jestctl", args[0], args[1], "[flags]", cmd.usage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&out.format, "o", settings.Output, "table or json.")
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+
+	err = fs.Parse(args[2:])
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+	err = validOutput(out.format)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	if settings.Server == "" {
+		fmt.Fprintln(stderr, "No server set, use -server, $JESTCTL_SERVER or the Server in "+settings.ConfigFile+".")
+		return 2
+	}
+
+	c := client.New(settings.Server, settings.Token)
+	c.HTTPClient, err = settings.HTTPClient()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	err = cmd.run(context.Background(), c, out, fs.Args())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		if _, ok := err.(usageError); ok {
+			fs.Usage()
+			return 2
+		}
+		return 1
+	}
+
+	return 0
+}
+
+// The command was given the wrong arguments.
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// Check the command was given exactly one name, and return it.
+func oneName(args []string, what string) (string, error) {
+	if len(args) != 1 {
+		return "", usageError("Give the name of one " + what + ".")
+	}
+	return args[0], nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Prints the results of a command as a table, or as the JSON the API returned.
+type output struct {
+	w      io.Writer
+	format string // table or json
+}
+
+/*
+	Print v as JSON, or the header and rows as a table. The rows are only built
+	if they're needed.
+*/
+func (o *output) print(v interface{}, header []string, rows func() [][]string) error {
+	if o.format == "json" {
+		enc := json.NewEncoder(o.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	tw := tabwriter.NewWriter(o.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows() {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// Print a message, or v as JSON.
+func (o *output) message(v interface{}, message string) error {
+	if o.format == "json" {
+		return o.print(v, nil, nil)
+	}
+
+	_, err := fmt.Fprintln(o.w, message)
+	return err
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+/*
+	Where jestctl finds Jest. The settings are read from the config file, then the
+	environment, then the flags given before the command, each overriding the one before.
+*/
+type Settings struct {
+	ConfigFile string `json:"-"`
+	Server     string // e.g. https://10.0.2.4
+	Token      string // The secret of the API token
+	CACert     string // A PEM certificate to trust, e.g. the one Jest generated for itself
+	Insecure   bool   // Don't verify the server's certificate
+	Output     string // table or json
+}
+
+var DefaultSettings = Settings{
+	Output: "table",
+}
+
+// ~/.jestctl.json
+func defaultConfigFile() string {
+	return filepath.Join(os.Getenv("HOME"), ".jestctl.json")
+}
+
+// Set every setting which is set in other.
+func (s *Settings) merge(other Settings) {
+	if other.Server != "" {
+		s.Server = other.Server
+	}
+	if other.Token != "" {
+		s.Token = other.Token
+	}
+	if other.CACert != "" {
+		s.CACert = other.CACert
+	}
+	if other.Insecure {
+		s.Insecure = true
+	}
+	if other.Output != "" {
+		s.Output = other.Output
+	}
+}
+
+func settingsFromEnv() (Settings, error) {
+	var env Settings
+	var err error
+
+	env.ConfigFile = os.Getenv("JESTCTL_CONFIG")
+	env.Server = os.Getenv("JESTCTL_SERVER")
+	env.Token = os.Getenv("JESTCTL_TOKEN")
+	env.CACert = os.Getenv("JESTCTL_CA_CERT")
+	env.Output = os.Getenv("JESTCTL_OUTPUT")
+	if insecure := os.Getenv("JESTCTL_INSECURE"); insecure != "" {
+		env.Insecure, err = strconv.ParseBool(insecure)
+		if err != nil {
+			return env, fmt.Errorf("JESTCTL_INSECURE should be true or false: %s", err)
+		}
+	}
+
+	return env, nil
+}
+
+// Read the config file. It's only an error for it to be missing if it was asked for.
+func settingsFromFile(path string, required bool) (Settings, error) {
+	var file Settings
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && required == false {
+			return file, nil
+		}
+		return file, err
+	}
+
+	err = json.Unmarshal(content, &file)
+	if err != nil {
+		return file, fmt.Errorf("Failed to decode the config file %s: %s", path, err)
+	}
+	return file, nil
+}
+
+// Parse the flags given before the command, returning the settings and the command.
+func ParseSettings(args []string) (Settings, []string, error) {
+	var flags Settings
+	settings := DefaultSettings
+
+	fs := flag.NewFlagSet("jestctl", flag.ContinueOnError)
+	fs.Usage = func() { usage(os.Stderr) }
+	fs.StringVar(&flags.ConfigFile, "config", "", "The JSON config file to read the settings from (default ~/.jestctl.json, $JESTCTL_CONFIG).")
+	fs.StringVar(&flags.Server, "server", "", "The address of Jest, e.g. https://10.0.2.4 ($JESTCTL_SERVER).")
+	fs.StringVar(&flags.Token, "token", "", "The secret of the API token ($JESTCTL_TOKEN).")
+	fs.StringVar(&flags.CACert, "ca-cert", "", "A PEM certificate to trust, e.g. Jest's self-signed certificate ($JESTCTL_CA_CERT).")
+	fs.BoolVar(&flags.Insecure, "insecure", false, "Don't verify Jest's certificate ($JESTCTL_INSECURE).")
+	fs.StringVar(&flags.Output, "o", "", "table or json (default table, $JESTCTL_OUTPUT).")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return settings, nil, err
+	}
+
+	env, err := settingsFromEnv()
+	if err != nil {
+		return settings, nil, err
+	}
+
+	settings.ConfigFile = defaultConfigFile()
+	required := true
+	switch {
+	case flags.ConfigFile != "":
+		settings.ConfigFile = flags.ConfigFile
+	case env.ConfigFile != "":
+		settings.ConfigFile = env.ConfigFile
+	default:
+		required = false
+	}
+
+	file, err := settingsFromFile(settings.ConfigFile, required)
+	if err != nil {
+		return settings, nil, err
+	}
+
+	settings.merge(file)
+	settings.merge(env)
+	settings.merge(flags)
+
+	err = validOutput(settings.Output)
+	if err != nil {
+		return settings, nil, err
+	}
+
+	return settings, fs.Args(), nil
+}
+
+func validOutput(output string) error {
+	if output != "table" && output != "json" {
+		return fmt.Errorf("The output " + output + " is not valid, it should be table or json.")
+	}
+	return nil
+}
+
+// The HTTP client to reach Jest with, trusting the CACert if one is set.
+func (s Settings) HTTPClient() (*http.Client, error) {
+	config := &tls.Config{InsecureSkipVerify: s.Insecure}
+
+	if s.CACert != "" {
+		pem, err := ioutil.ReadFile(s.CACert)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if pool.AppendCertsFromPEM(pem) == false {
+			return nil, fmt.Errorf("The CA certificate %s doesn't contain any PEM certificates.", s.CACert)
+		}
+		config.RootCAs = pool
+	}
+
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: config}
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/altsrc-io/Jest/client"
+	"github.com/altsrc-io/Jest/model"
+	"strconv"
+)
+
+var snapshotHeader = []string{"NAME", "TARGET", "TEMPLATE", "USED", "DATASET"}
+
+func snapshotRow(s model.Snapshot) []string {
+	return []string{s.Name, s.Target, yesNo(s.IsTemplate), strconv.FormatUint(s.Used, 10), s.Dataset}
+}
+
+func init() {
+	list := &command{
+		help: "List the snapshots",
+		run: func(ctx context.Context, c *client.Client, out *output, args []string) error {
+			snapshots, err := c.Snapshots(ctx)
+			if err != nil {
+				return err
+			}
+
+			return out.print(snapshots, snapshotHeader, func() [][]string {
+				var rows [][]string
+				for _, s := range snapshots {
+					rows = append(rows, snapshotRow(s))
+				}
+				return rows
+			})
+		},
+	}
+	register("snapshot", "ls", list)
+	register("snapshot", "list", list)
+
+	register("snapshot", "create", &command{
+		usage: "<jail>@<snapshot>",
+		help:  "Snapshot a jail, or a template as .<template>@<snapshot>",
+		run: func(ctx context.Context, c *client.Client, out *output, args []string) error {
+			name, err := oneName(args, "snapshot")
+			if err != nil {
+				return err
+			}
+
+			snap, err := c.CreateSnapshot(ctx, name)
+			if err != nil {
+				return err
+			}
+
+			return out.print(snap, snapshotHeader, func() [][]string { return [][]string{snapshotRow(snap)} })
+		},
+	})
+
+	var destroyMoreRecent bool
+	register("snapshot", "rollback", &command{
+		usage: "<jail>@<snapshot>",
+		help:  "Roll a stopped jail back to a snapshot",
+		flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&destroyMoreRecent, "destroy-more-recent", false, "Destroy any snapshots taken after this one.")
+		},
+		run: func(ctx context.Context, c *client.Client, out *output, args []string) error {
+			name, err := oneName(args, "snapshot")
+			if err != nil {
+				return err
+			}
+
+			snap, err := c.RollbackSnapshot(ctx, name, destroyMoreRecent)
+			if err != nil {
+				return err
+			}
+
+			return out.message(snap, "Rolled "+snap.Target+" back to "+snap.Name+".")
+		},
+	})
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"github.com/altsrc-io/Jest/client"
+)
+
+func init() {
+	list := &command{
+		help: "List the templates",
+		run: func(ctx context.Context, c *client.Client, out *output, args []string) error {
+			templates, err := c.Templates(ctx)
+			if err != nil {
+				return err
+			}
+
+			return out.print(templates, []string{"NAME", "VERSION", "DISABLED", "PATH"}, func() [][]string {
+				var rows [][]string
+				for _, t := range templates {
+					rows = append(rows, []string{t.Name, t.Version, yesNo(t.Disabled), t.Path})
+				}
+				return rows
+			})
+		},
+	}
+	register("template", "ls", list)
+	register("template", "list", list)
+}
@@ -0,0 +1,122 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+/*
+	Every command Jest runs on the host goes through a Runner, so the commands
+	can be recorded in tests or just logged in a dry run. Commands are always run
+	from an argument vector, never through a shell.
+*/
+type Runner interface {
+	Run(stdin io.Reader, name string, arg ...string) (stdout []byte, stderr []byte, err error)
+}
+
+// Runs the commands on the host.
+type ExecRunner struct{}
+
+func (ExecRunner) Run(stdin io.Reader, name string, arg ...string) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(name, arg...)
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// Logs the commands it would run, and pretends they succeeded without any output.
+type DryRunRunner struct{}
+
+func (DryRunRunner) Run(stdin io.Reader, name string, arg ...string) ([]byte, []byte, error) {
+	log.WithFields(log.Fields{"command": commandLine(name, arg)}).Info("Dry run - not executing command.")
+	return nil, nil, nil
+}
+
+type RecordedCommand struct {
+	Name  string
+	Args  []string
+	Stdin string
+}
+
+type RecordedResult struct {
+	Stdout string
+	Stderr string
+	Err    error
+}
+
+/*
+	Records every command it's asked to run. Results are looked up by the command line,
+	e.g. "jail -f /usr/jail/.jest/jails/mash.conf -c mash", and commands without a result
+	succeed with no output.
+*/
+type RecordingRunner struct {
+	mu       sync.Mutex
+	Commands []RecordedCommand
+	Results  map[string]RecordedResult
+}
+
+func (r *RecordingRunner) Run(stdin io.Reader, name string, arg ...string) ([]byte, []byte, error) {
+	var in []byte
+	if stdin != nil {
+		in, _ = ioutil.ReadAll(stdin)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Commands = append(r.Commands, RecordedCommand{name, arg, string(in)})
+
+	result := r.Results[commandLine(name, arg)]
+	return []byte(result.Stdout), []byte(result.Stderr), result.Err
+}
+
+// The command lines run so far, in order.
+func (r *RecordingRunner) CommandLines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lines := []string{}
+	for c := range r.Commands {
+		lines = append(lines, commandLine(r.Commands[c].Name, r.Commands[c].Args))
+	}
+	return lines
+}
+
+func commandLine(name string, arg []string) string {
+	return strings.TrimSpace(name + " " + strings.Join(arg, " "))
+}
+
+/*
+	Run a command through the runner and return its stdout.
+	If it fails, the error includes whatever the command wrote to stderr.
+*/
+func Run(runner Runner, stdin io.Reader, name string, arg ...string) (string, error) {
+	stdout, _, err := RunOutput(runner, stdin, name, arg...)
+	return stdout, err
+}
+
+// Run a command like Run, but return its stderr as well, for commands whose output is reported back.
+func RunOutput(runner Runner, stdin io.Reader, name string, arg ...string) (string, string, error) {
+	log.WithFields(log.Fields{"command": commandLine(name, arg)}).Debug("Executing command.")
+	stdout, stderr, err := runner.Run(stdin, name, arg...)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "command": commandLine(name, arg), "output": string(stdout), "stderr": string(stderr)}).Warning("Command failed.")
+		if len(bytes.TrimSpace(stderr)) > 0 {
+			return string(stdout), string(stderr), fmt.Errorf("%s: %s", err, strings.TrimSpace(string(stderr)))
+		}
+		return string(stdout), string(stderr), err
+	}
+
+	return string(stdout), string(stderr), nil
+}
@@ -0,0 +1,54 @@
+package command
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecordingRunner(t *testing.T) {
+	runner := &RecordingRunner{Results: map[string]RecordedResult{
+		"jls -d -v --libxo json": {Stdout: `{"jail-information": {"jail": []}}`},
+		"jail -R mash":           {Stderr: "jail: mash: not found", Err: fmt.Errorf("exit status 1")},
+	}}
+
+	out, err := Run(runner, strings.NewReader("input"), "jls", "-d", "-v", "--libxo", "json")
+	if err != nil || out != `{"jail-information": {"jail": []}}` {
+		t.Errorf("Run(jls) = %q, %v, want the recorded result", out, err)
+	}
+
+	stdout, stderr, err := RunOutput(runner, nil, "jail", "-R", "mash")
+	if err == nil || strings.Contains(err.Error(), "jail: mash: not found") == false {
+		t.Errorf("RunOutput(jail -R) error = %v, want the recorded stderr in it", err)
+	}
+	if stdout != "" || stderr != "jail: mash: not found" {
+		t.Errorf("RunOutput(jail -R) = %q, %q, want the recorded stderr", stdout, stderr)
+	}
+
+	out, err = Run(runner, nil, "hostname")
+	if err != nil || out != "" {
+		t.Errorf("Run(hostname) = %q, %v, want commands without a result to succeed", out, err)
+	}
+
+	want := []RecordedCommand{
+		{"jls", []string{"-d", "-v", "--libxo", "json"}, "input"},
+		{"jail", []string{"-R", "mash"}, ""},
+		{"hostname", nil, ""},
+	}
+	if reflect.DeepEqual(runner.Commands, want) == false {
+		t.Errorf("Commands = %+v, want %+v", runner.Commands, want)
+	}
+
+	lines := []string{"jls -d -v --libxo json", "jail -R mash", "hostname"}
+	if reflect.DeepEqual(runner.CommandLines(), lines) == false {
+		t.Errorf("CommandLines() = %q, want %q", runner.CommandLines(), lines)
+	}
+}
+
+func TestDryRunRunner(t *testing.T) {
+	stdout, stderr, err := RunOutput(DryRunRunner{}, nil, "jail", "-f", "/usr/jail/.jest/jails/mash.conf", "-c", "mash")
+	if stdout != "" || stderr != "" || err != nil {
+		t.Errorf("RunOutput in a dry run = %q, %q, %v, want nothing", stdout, stderr, err)
+	}
+}
@@ -0,0 +1,202 @@
+/*
+	Package config is the host's Jest config. Every version of it is kept in JestDB,
+	only the newest is enabled, and an old version can be rolled back to by saving
+	it again.
+*/
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/model"
+	"github.com/altsrc-io/Jest/store"
+	"github.com/boltdb/bolt"
+	"github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"time"
+)
+
+// The config, the parameters applied to jails created with UseDefaults and the TLS settings, as the API sends them.
+type (
+	Config       = model.Config
+	JailDefaults = model.JailDefaults
+	TLSConfig    = model.TLSConfig
+)
+
+const DefaultListenAddr = ":443"
+
+// The mirror used until the config says otherwise, see Config.FTPMirror
+const FTPSite = "ftp5.us.freebsd.org:21"
+
+var DefaultJailDefaults = JailDefaults{
+	AllowRawSockets:  `0`,
+	AllowMount:       `0`,
+	AllowSetHostname: `0`,
+	AllowSysVIPC:     `0`,
+	Clean:            `0`,
+	JailUser:         "root",
+	SystemUser:       "root",
+	Start:            `/bin/sh /etc/rc`,
+	Stop:             `/bin/sh /etc/rc.shutdown`,
+	StopTimeout:      `30`,
+}
+
+// The defaults with every field the update sets replaced, and the rest kept.
+func MergeJailDefaults(defaults JailDefaults, update JailDefaults) JailDefaults {
+	merged := defaults
+	fields := []struct {
+		value string
+		field *string
+	}{
+		{update.AllowRawSockets, &merged.AllowRawSockets},
+		{update.AllowMount, &merged.AllowMount},
+		{update.AllowSetHostname, &merged.AllowSetHostname},
+		{update.AllowSysVIPC, &merged.AllowSysVIPC},
+		{update.Clean, &merged.Clean},
+		{update.JailUser, &merged.JailUser},
+		{update.SystemUser, &merged.SystemUser},
+		{update.Start, &merged.Start},
+		{update.Stop, &merged.Stop},
+		{update.StopTimeout, &merged.StopTimeout},
+	}
+
+	for f := range fields {
+		if fields[f].value != "" {
+			*fields[f].field = fields[f].value
+		}
+	}
+	return merged
+}
+
+// Load the enabled config with the highest version.
+func Load(db *bolt.DB) (Config, error) {
+	var config = Config{}
+	var validConfig = Config{}
+	found := false
+
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.ConfigBucket)
+
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			config = Config{}
+			encoded := bytes.NewReader(v)
+			err := json.NewDecoder(encoded).Decode(&config)
+			if err != nil {
+				log.Warn("Couldn't decode a key:", err)
+			}
+
+			if config.Disabled == false && (found == false || config.Version > validConfig.Version) {
+				validConfig = config
+				found = true
+			}
+		}
+		return nil
+	})
+
+	// Configs written before these settings existed
+	if validConfig.JailDefaults == (JailDefaults{}) {
+		validConfig.JailDefaults = DefaultJailDefaults
+	}
+	if validConfig.FTPMirror == "" {
+		validConfig.FTPMirror = FTPSite
+	}
+	if validConfig.ListenAddr == "" {
+		validConfig.ListenAddr = DefaultListenAddr
+	}
+
+	if found {
+		return validConfig, nil
+	}
+
+	return validConfig, fmt.Errorf("Failed to load the config file")
+}
+
+// Every config ever saved on this host, oldest first.
+func List(db *bolt.DB) []Config {
+	var configs = []Config{}
+
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.ConfigBucket)
+
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			encoded := bytes.NewReader(v)
+			form := Config{}
+			err := json.NewDecoder(encoded).Decode(&form)
+			if err != nil {
+				log.Warn("Couldn't decode a key:", err)
+			}
+
+			configs = append(configs, form)
+		}
+		return nil
+	})
+
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].Version < configs[j].Version
+	})
+
+	return configs
+}
+
+/*
+	Save the config as a new version and disable every older version,
+	so the history is kept and any of them can be rolled back to.
+*/
+func Save(db *bolt.DB, config Config) (Config, error) {
+	cUID := uuid.NewV4()
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.ConfigBucket)
+		c := b.Cursor()
+
+		latest := 0
+		disabled := make(map[string][]byte)
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			form := Config{}
+			err := json.NewDecoder(bytes.NewReader(v)).Decode(&form)
+			if err != nil {
+				log.Warn("Couldn't decode a key:", err)
+				continue
+			}
+
+			if form.Version > latest {
+				latest = form.Version
+			}
+
+			if form.Disabled == false {
+				form.Disabled = true
+				encoded, err := json.Marshal(form)
+				if err != nil {
+					return err
+				}
+				disabled[string(k)] = encoded
+			}
+		}
+
+		// Changing values while the cursor is open can invalidate it.
+		for k, v := range disabled {
+			err := b.Put([]byte(k), v)
+			if err != nil {
+				return err
+			}
+		}
+
+		config.Disabled = false
+		config.Version = latest + 1
+		config.Created = time.Now()
+
+		encoded, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+		return b.Put(cUID.Bytes(), encoded)
+	})
+
+	return config, err
+}
@@ -0,0 +1,229 @@
+/*
+	Package host is the FreeBSD host Jest manages: the ZFS dataset Jest is initialised in,
+	JestDB and the config kept in it, and the commands run on the host. The jail, template
+	and snapshot packages all work through a Host.
+*/
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/command"
+	"github.com/altsrc-io/Jest/config"
+	"github.com/altsrc-io/Jest/model"
+	"github.com/altsrc-io/Jest/store"
+	"github.com/altsrc-io/Jest/zfs"
+	"github.com/boltdb/bolt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"path/filepath"
+)
+
+type Host struct {
+	Storage   zfs.Storage
+	Runner    command.Runner
+	Dataset   string // Only look for Jest in this dataset, rather than searching every dataset
+	FTPMirror string // Overrides the FTPMirror in the config
+
+	JestDir       string
+	IsInitialised bool
+	DB            *bolt.DB
+	Conf          config.Config
+}
+
+type ZFSParams = model.ZFSParams
+
+func New(storage zfs.Storage, runner command.Runner) *Host {
+	return &Host{Storage: storage, Runner: runner, JestDir: "Not set", DB: &bolt.DB{}}
+}
+
+/*
+	Find out whether the host has been initialised, and open JestDB and load the config
+	if it has. A host which hasn't been initialised isn't an error.
+*/
+func (h *Host) Load() error {
+	var err error
+	h.JestDir, h.IsInitialised, err = h.InitStatus()
+	if err != nil {
+		log.Warn(err)
+		return nil
+	}
+
+	h.DB, err = h.OpenDB()
+	if err != nil {
+		return err
+	}
+
+	h.Conf, _ = config.Load(h.DB)
+	return nil
+}
+
+func (h *Host) Close() error {
+	if h.IsInitialised == false {
+		return nil
+	}
+	return h.DB.Close()
+}
+
+// Find the Jest directory from the jest:dir property, only looking at the Dataset if it's set.
+func (h *Host) InitStatus() (string, bool, error) {
+	var path string
+	var err error
+
+	if h.Dataset != "" {
+		path, err = h.Storage.GetProperty(h.Dataset, "jest:dir")
+		if err == nil && (path == "" || path == "-") {
+			err = fmt.Errorf("The dataset " + h.Dataset + " doesn't have the property jest:dir set - please initialise Jest.")
+		}
+	} else {
+		path, err = h.SearchZFSProperties("jest:dir")
+	}
+	if err != nil {
+		return "Not set", false, err
+	}
+
+	return path, true, nil
+}
+
+func (h *Host) OpenDB() (*bolt.DB, error) {
+	if h.IsInitialised == true {
+		return store.Open(h.JestDir)
+	}
+
+	return &bolt.DB{}, fmt.Errorf("Host not initialised - cannot load JestDB")
+}
+
+// Run a command through the host's Runner.
+func (h *Host) RunCommand(stdin io.Reader, name string, arg ...string) (string, error) {
+	return command.Run(h.Runner, stdin, name, arg...)
+}
+
+// Run a command through the host's Runner, returning its stderr as well as its stdout.
+func (h *Host) RunCommandOutput(stdin io.Reader, name string, arg ...string) (string, string, error) {
+	return command.RunOutput(h.Runner, stdin, name, arg...)
+}
+
+// The FreeBSD FTP mirror to download templates from.
+func (h *Host) FTPSite() string {
+	if h.FTPMirror != "" {
+		return h.FTPMirror
+	}
+	if h.Conf.FTPMirror != "" {
+		return h.Conf.FTPMirror
+	}
+	return config.FTPSite
+}
+
+// Create the Jest dataset, the .jest dataset JestDB lives in, and the dataset for the first template.
+func (h *Host) InitDataset(params ZFSParams, templateName string) ([]zfs.Dataset, error) {
+	var datasets []zfs.Dataset
+
+	rootOpts := make(map[string]string)
+	rootOpts["mountpoint"] = params.Mountpoint
+	if params.Compression {
+		rootOpts["compression"] = "on"
+	}
+	rootJailDataset, err := h.CreateZFSDataset(params.Name, rootOpts)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "filesystem": params.Name}).Warning("Failed to create dataset")
+		return datasets, err
+	}
+
+	jestOpts := map[string]string{"mountpoint": filepath.Join(params.Mountpoint, ".jest")}
+	jestDataset, err := h.CreateZFSDataset(params.Name+"/.jest", jestOpts)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "filesystem": params.Name}).Warning("Failed to create dataset")
+		return datasets, err
+	}
+
+	baseOpts := map[string]string{"mountpoint": filepath.Join(params.Mountpoint, "."+templateName)}
+	baseJailDataset, err := h.CreateZFSDataset(params.Name+"/."+templateName, baseOpts)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "filesystem": params.Name}).Warning("Failed to create dataset")
+		return datasets, err
+	}
+
+	//ToDo: Handle the error here properly
+	err = h.Storage.SetProperty(rootJailDataset.Name, "jest:dir", filepath.Join(params.Mountpoint, "/.jest"))
+	if err != nil {
+		log.Warn(err)
+	}
+
+	datasets = append(datasets, *rootJailDataset, *baseJailDataset, *jestDataset)
+	return datasets, nil
+}
+
+/*
+	The lines Jest adds to /etc/rc.conf, jail_enable for the jail subsystem. The jest_boot
+	rc.d script isn't installed by Jest, so it's enabled with it, see the README.
+*/
+var rcConfLines = []string{`jail_enable="YES"`}
+
+// The key the lines PrepareHostConfig added are saved under in the HostBucket.
+var rcConfLinesKey = []byte("rcConfLines")
+
+/*
+	Add the rcConfLines /etc/rc.conf doesn't already have, returning the ones which
+	were added, so only those are removed again.
+*/
+func PrepareHostConfig() ([]string, error) {
+	var added []string
+	for l := range rcConfLines {
+		exists, _ := CheckFileForString("/etc/rc.conf", rcConfLines[l])
+		if exists {
+			log.WithFields(log.Fields{"fileName": "/etc/rc.conf"}).Debug(rcConfLines[l] + " is already in /etc/rc.conf")
+			continue
+		}
+
+		log.WithFields(log.Fields{"fileName": "/etc/rc.conf"}).Debug("Adding " + rcConfLines[l] + " to /etc/rc.conf")
+		err := AppendStringToFile("/etc/rc.conf", rcConfLines[l]+"\n")
+		if err != nil {
+			log.WithFields(log.Fields{"fileName": "/etc/rc.conf", "error": err}).Warning("Failed to append the line to the config file.")
+			return added, err
+		}
+		added = append(added, rcConfLines[l])
+	}
+
+	return added, nil
+}
+
+// Record the lines PrepareHostConfig added in JestDB.
+func (h *Host) SaveHostConfig(added []string) error {
+	encoded, err := json.Marshal(added)
+	if err != nil {
+		return err
+	}
+
+	return h.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(store.HostBucket).Put(rcConfLinesKey, encoded)
+	})
+}
+
+/*
+	The lines PrepareHostConfig added, from JestDB. Hosts initialised before they were
+	recorded have none, so nothing is removed from their /etc/rc.conf.
+*/
+func (h *Host) AddedHostConfig() ([]string, error) {
+	var added []string
+	err := h.DB.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(store.HostBucket).Get(rcConfLinesKey)
+		if v == nil {
+			return nil
+		}
+		return json.Unmarshal(v, &added)
+	})
+	return added, err
+}
+
+// Remove the lines PrepareHostConfig added, leaving the ones which were already there.
+func RemoveHostConfig(added []string) error {
+	for l := range added {
+		_, err := RemoveStringFromFile("/etc/rc.conf", added[l])
+		if err != nil {
+			log.WithFields(log.Fields{"fileName": "/etc/rc.conf", "error": err}).Warning("Failed to remove the line from the config file.")
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,4 +1,4 @@
-package main
+package host
 
 import (
 	"github.com/mholt/archiver"
@@ -32,7 +32,7 @@ func AppendStringToFile(path, text string) error {
 }
 
 func RandomString(strlen int) string {
-	r = rand.New(rand.NewSource(time.Now().UnixNano()))
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	const chars = "abcdefghijklmnopqrstuvwxyz0123456789"
 	result := make([]byte, strlen)
 	for i := range result {
@@ -134,3 +134,83 @@ func CheckFileForString(file string, str string) (bool, error) {
 		return false, nil
 	}
 }
+
+/*
+	Remove every line matching the string exactly from a file.
+	Returns false if there was nothing to remove.
+*/
+func RemoveStringFromFile(file string, str string) (bool, error) {
+	f, err := ioutil.ReadFile(file)
+	if err != nil {
+		return false, err
+	}
+
+	removed := false
+	lines := strings.SplitAfter(string(f), "\n")
+	kept := make([]string, 0, len(lines))
+	for i := range lines {
+		if strings.TrimRight(lines[i], "\n") == str {
+			removed = true
+			continue
+		}
+		kept = append(kept, lines[i])
+	}
+
+	if removed == false {
+		log.WithFields(log.Fields{"fileName": file}).Debug(str + " not found in " + file)
+		return false, nil
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return false, err
+	}
+
+	log.WithFields(log.Fields{"fileName": file}).Debug("Removing " + str + " from " + file)
+	return true, ioutil.WriteFile(file, []byte(strings.Join(kept, "")), info.Mode())
+}
+
+/*
+	Append each line to the file unless the file already has it, creating the file if needed.
+	The lines shouldn't end with a newline.
+*/
+func AppendMissingLinesToFile(file string, lines []string) error {
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	existing, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	have := make(map[string]bool)
+	for _, line := range strings.Split(string(existing), "\n") {
+		have[line] = true
+	}
+
+	// Don't join our first line on to the end of the file's last one.
+	if len(existing) > 0 && strings.HasSuffix(string(existing), "\n") == false {
+		_, err = f.WriteString("\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range lines {
+		if have[lines[i]] {
+			log.WithFields(log.Fields{"fileName": file, "line": lines[i]}).Debug("Line already exists in file - skipping.")
+			continue
+		}
+
+		log.WithFields(log.Fields{"fileName": file, "line": lines[i]}).Debug("Adding line to file.")
+		_, err = f.WriteString(lines[i] + "\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
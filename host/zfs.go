@@ -0,0 +1,90 @@
+package host
+
+import (
+	"fmt"
+	"github.com/altsrc-io/Jest/zfs"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+func (h *Host) SearchZFSProperties(property string) (string, error) {
+	log.Debug("Looking for ZFS datasets with the property " + property + " set.")
+	list, err := h.Storage.Datasets()
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Warning("Error reading ZFS datasets.")
+		return "", err
+	}
+
+	for d := range list {
+		zfsProperty, _ := h.Storage.GetProperty(list[d].Name, property)
+		if zfsProperty != "" {
+			if zfsProperty != "-" {
+				return zfsProperty, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("Couldn't find any ZFS datasets with the property " + property + " - please initialise Jest.")
+}
+
+func (h *Host) ListAllZFSDatasets() ([]*zfs.Dataset, error) {
+	datasets, err := h.Storage.Datasets()
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Warning("Error reading ZFS datasets.")
+		return []*zfs.Dataset{}, err
+	}
+
+	return datasets, nil
+}
+
+// Find the Ready snapshot of the dataset, which jails are cloned from.
+func (h *Host) FindZFSSnapshot(name string) (*zfs.Dataset, error) {
+	snapshot, err := h.Storage.GetDataset(name + "@Ready")
+	if err != nil {
+		return &zfs.Dataset{}, fmt.Errorf("Failed to find the snapshot: %s", err)
+	}
+	return snapshot, nil
+}
+
+func (h *Host) SnapshotZFSDataset(dataset zfs.Dataset) (*zfs.Dataset, error) {
+	snapshot, err := h.Storage.Snapshot(dataset.Name, "Ready")
+	return snapshot, err
+}
+
+func (h *Host) CreateZFSDataset(filesystem string, params map[string]string) (*zfs.Dataset, error) {
+	log.WithFields(log.Fields{"dataset": filesystem, "params": params}).Debug("Creating dataset.")
+	dataset, err := h.Storage.CreateFilesystem(filesystem, params)
+	return dataset, err
+}
+
+func (h *Host) CloneZFSSnapshot(snapshot *zfs.Dataset, destination string, properties map[string]string) (*zfs.Dataset, error) {
+	log.WithFields(log.Fields{"snapshot": snapshot.Name, "destination": destination}).Debug("Cloning snapshot to dataset.")
+
+	newDataset, err := h.Storage.Clone(snapshot.Name, destination, properties)
+
+	return newDataset, err
+}
+
+// Remove a property set on the dataset, so it inherits the value from its parent again.
+func (h *Host) ClearZFSProperty(dataset string, property string) error {
+	log.WithFields(log.Fields{"dataset": dataset, "property": property}).Debug("Clearing property.")
+	return h.Storage.InheritProperty(dataset, property)
+}
+
+/*
+	Destroy the dataset, and all of its snapshots if recursive is set.
+	Returns nil if the dataset doesn't exist, so a failed teardown can be retried.
+*/
+func (h *Host) DestroyZFSDataset(name string, recursive bool) error {
+	_, err := h.Storage.GetDataset(name)
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			log.WithFields(log.Fields{"dataset": name}).Debug("Dataset doesn't exist - skipping.")
+			return nil
+		}
+		return err
+	}
+
+	log.WithFields(log.Fields{"dataset": name, "recursive": recursive}).Debug("Destroying dataset.")
+	return h.Storage.Destroy(name, recursive)
+}
@@ -0,0 +1,174 @@
+package jail
+
+import (
+	"fmt"
+	"github.com/altsrc-io/Jest/host"
+	"github.com/altsrc-io/Jest/model"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// What starting or stopping a jail printed, see model.JailOutput.
+type Output = model.JailOutput
+
+type StopOptions struct {
+	Timeout int  // Seconds, overrides the jail's StopTimeout unless it's 0
+	Force   bool // Remove the jail with jail -R if exec.stop fails or times out
+}
+
+// Only the end of a long console log is returned.
+const maxConsoleLog = 64 * 1024
+
+func runOutput(h *host.Host, o *Output, name string, arg ...string) error {
+	o.Commands = append(o.Commands, strings.TrimSpace(name+" "+strings.Join(arg, " ")))
+	stdout, stderr, err := h.RunCommandOutput(nil, name, arg...)
+	o.Stdout += stdout
+	o.Stderr += stderr
+	return err
+}
+
+// The size of the console log before a command, to find what the command added to it.
+func consoleLogSize(jail Config) int64 {
+	if jail.ConsoleLog == "" {
+		return 0
+	}
+
+	info, err := os.Stat(jail.ConsoleLog)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+func readConsoleLog(o *Output, jail Config, from int64) {
+	if jail.ConsoleLog == "" {
+		return
+	}
+
+	f, err := os.Open(jail.ConsoleLog)
+	if err != nil {
+		if os.IsNotExist(err) == false {
+			log.WithFields(log.Fields{"error": err, "jail": jail.JailName, "fileName": jail.ConsoleLog}).Warn("Couldn't read the console log.")
+		}
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	// The log was truncated or rotated while the command ran.
+	if info.Size() < from {
+		from = 0
+	}
+	if info.Size()-from > maxConsoleLog {
+		from = info.Size() - maxConsoleLog
+	}
+
+	_, err = f.Seek(from, 0)
+	if err != nil {
+		return
+	}
+	added, _ := ioutil.ReadAll(f)
+	o.ConsoleLog += string(added)
+}
+
+func Start(h *host.Host, jail Config) (State, error) {
+	state, _, err := StartWithOutput(h, jail)
+	return state, err
+}
+
+// Start the jail, returning what exec.start printed as well as its state.
+func StartWithOutput(h *host.Host, jail Config) (State, Output, error) {
+	var output Output
+
+	conf, err := WriteConf(h, jail)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "jail": jail.JailName}).Warning("Couldn't write the jail.conf.")
+		return State{}, output, err
+	}
+
+	from := consoleLogSize(jail)
+	err = runOutput(h, &output, "jail", "-f", conf, "-c", jail.JailName)
+	readConsoleLog(&output, jail, from)
+	if err != nil {
+		return State{}, output, err
+	}
+
+	jailStatus, err := Status(h, jail)
+	return jailStatus, output, err
+}
+
+func Stop(h *host.Host, jail Config) (State, error) {
+	state, _, err := StopWithOutput(h, jail, StopOptions{})
+	return state, err
+}
+
+/*
+	Stop the jail with its exec.stop, which gets the StopTimeout to finish. If it fails
+	or times out and Force is set, the jail is removed with jail -R, which kills its
+	processes without running exec.stop.
+*/
+func StopWithOutput(h *host.Host, jail Config, opts StopOptions) (State, Output, error) {
+	var output Output
+
+	if opts.Timeout > 0 {
+		jail.StopTimeout = strconv.Itoa(opts.Timeout)
+	}
+
+	// Written again in case the jail was started before Jest wrote jail.conf files.
+	conf, err := writeConf(h, jail, true)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "jail": jail.JailName}).Warning("Couldn't write the jail.conf.")
+		return State{}, output, err
+	}
+
+	from := consoleLogSize(jail)
+	err = runOutput(h, &output, "jail", "-f", conf, "-r", jail.JailName)
+	if err != nil && opts.Force {
+		log.WithFields(log.Fields{"error": err, "jail": jail.JailName}).Warn("Couldn't stop the jail, removing it with jail -R.")
+		output.Forced = true
+
+		forceErr := runOutput(h, &output, "jail", "-R", jail.JailName)
+		if forceErr != nil {
+			err = fmt.Errorf("%s, and it couldn't be removed with jail -R: %s", err, forceErr)
+		} else {
+			err = nil
+		}
+	}
+	readConsoleLog(&output, jail, from)
+	if err != nil {
+		return State{}, output, err
+	}
+
+	jailStatus, err := Status(h, jail)
+	return jailStatus, output, err
+}
+
+// Stop the jail if it's running, and start it again.
+func Restart(h *host.Host, jail Config, opts StopOptions) (State, Output, error) {
+	var output Output
+
+	state, err := Status(h, jail)
+	if err != nil {
+		return state, output, err
+	}
+
+	if state.Running {
+		state, output, err = StopWithOutput(h, jail, opts)
+		if err != nil {
+			return state, output, err
+		}
+	}
+
+	state, started, err := StartWithOutput(h, jail)
+	output.Commands = append(output.Commands, started.Commands...)
+	output.Stdout += started.Stdout
+	output.Stderr += started.Stderr
+	output.ConsoleLog += started.ConsoleLog
+	return state, output, err
+}
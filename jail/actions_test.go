@@ -0,0 +1,224 @@
+package jail
+
+import (
+	"fmt"
+	"github.com/altsrc-io/Jest/command"
+	"github.com/altsrc-io/Jest/config"
+	"github.com/altsrc-io/Jest/host"
+	"github.com/altsrc-io/Jest/template"
+	"github.com/altsrc-io/Jest/zfs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/*
+	An initialised host on a MemoryStorage, with a default template to clone jails from,
+	which runs its commands through the runner. Call the returned func to remove it.
+*/
+func testHost(t *testing.T, runner command.Runner) (*host.Host, func()) {
+	dir, err := ioutil.TempDir("", "jest-jail")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := zfs.NewMemoryStorage("zroot")
+	storage.CreateFilesystem("zroot/jails", map[string]string{"mountpoint": dir})
+	storage.SetProperty("zroot/jails", "jest:dir", filepath.Join(dir, ".jest"))
+	storage.CreateFilesystem("zroot/jails/.default", map[string]string{"mountpoint": filepath.Join(dir, ".default")})
+	storage.Snapshot("zroot/jails/.default", "Ready")
+	os.MkdirAll(filepath.Join(dir, ".jest"), 0700)
+
+	h := host.New(storage, runner)
+	h.Dataset = "zroot/jails"
+	err = h.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = config.Save(h.DB, config.Config{JestDir: dir, JestDataset: "zroot/jails", DefaultTemplate: "default", JailDefaults: config.DefaultJailDefaults})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Conf, _ = config.Load(h.DB)
+
+	err = template.Put(h, template.Template{Name: "default", ZFSParams: host.ZFSParams{Name: "zroot/jails"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return h, func() {
+		h.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func createTestJail(t *testing.T, h *host.Host, name string) Config {
+	form := Config{JailName: name, Hostname: name + ".local", IPV4Addr: "10.0.2.12", Template: "default", UseDefaults: true}
+	err := Validate(h, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Create(h, "3254ec98-e683-429a-9849-7e432c24c01b", form, "bootstrap")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return WithDefaults(h, form)
+}
+
+func argv(commands []command.RecordedCommand) [][]string {
+	var recorded [][]string
+	for c := range commands {
+		recorded = append(recorded, append([]string{commands[c].Name}, commands[c].Args...))
+	}
+	return recorded
+}
+
+var jlsArgv = []string{"jls", "-d", "-v", "--libxo", "json"}
+
+func TestCreateOnlyClones(t *testing.T) {
+	runner := &command.RecordingRunner{}
+	h, cleanup := testHost(t, runner)
+	defer cleanup()
+
+	createTestJail(t, h, "mash")
+
+	if len(runner.Commands) != 0 {
+		t.Errorf("Create ran %v, want no commands, the jail is cloned through the Storage", argv(runner.Commands))
+	}
+	if _, err := h.Storage.GetDataset("zroot/jails/mash"); err != nil {
+		t.Errorf("Create didn't clone the template: %s", err)
+	}
+	if owner := Owner(h, "mash"); owner != "bootstrap" {
+		t.Errorf("Owner(mash) = %q, want bootstrap", owner)
+	}
+}
+
+func TestStartRunsJailCreate(t *testing.T) {
+	runner := &command.RecordingRunner{}
+	h, cleanup := testHost(t, runner)
+	defer cleanup()
+	conf := createTestJail(t, h, "mash")
+
+	_, output, err := StartWithOutput(h, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	confPath := ConfPath(h, "mash")
+	want := [][]string{{"jail", "-f", confPath, "-c", "mash"}, jlsArgv}
+	if got := argv(runner.Commands); reflect.DeepEqual(got, want) == false {
+		t.Errorf("Start ran %q, want %q", got, want)
+	}
+	if len(output.Commands) != 1 || output.Commands[0] != "jail -f "+confPath+" -c mash" {
+		t.Errorf("Output.Commands = %q, want the jail -c", output.Commands)
+	}
+
+	written, err := ioutil.ReadFile(confPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{`host.hostname = "mash.local";`, `ip4.addr = "10.0.2.12";`, `exec.start += "/bin/sh /etc/rc";`} {
+		if strings.Contains(string(written), line) == false {
+			t.Errorf("jail.conf doesn't have %s:\n%s", line, written)
+		}
+	}
+	if strings.Contains(string(written), ExecTimeoutLine) {
+		t.Errorf("jail.conf for starting has an exec.timeout:\n%s", written)
+	}
+}
+
+func TestStopRunsJailRemove(t *testing.T) {
+	runner := &command.RecordingRunner{}
+	h, cleanup := testHost(t, runner)
+	defer cleanup()
+	conf := createTestJail(t, h, "mash")
+
+	_, err := Stop(h, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{{"jail", "-f", ConfPath(h, "mash"), "-r", "mash"}, jlsArgv}
+	if got := argv(runner.Commands); reflect.DeepEqual(got, want) == false {
+		t.Errorf("Stop ran %q, want %q", got, want)
+	}
+
+	written, err := ioutil.ReadFile(ConfPath(h, "mash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(written), ExecTimeoutLine+`"30";`) == false {
+		t.Errorf("jail.conf for stopping doesn't have the StopTimeout as the exec.timeout:\n%s", written)
+	}
+}
+
+func TestStopForcesRemoval(t *testing.T) {
+	runner := &command.RecordingRunner{Results: map[string]command.RecordedResult{}}
+	h, cleanup := testHost(t, runner)
+	defer cleanup()
+	conf := createTestJail(t, h, "mash")
+
+	confPath := ConfPath(h, "mash")
+	runner.Results["jail -f "+confPath+" -r mash"] = command.RecordedResult{Stderr: "jail: mash: exec.stop timed out", Err: fmt.Errorf("exit status 1")}
+
+	_, output, err := StopWithOutput(h, conf, StopOptions{Timeout: 5, Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{{"jail", "-f", confPath, "-r", "mash"}, {"jail", "-R", "mash"}, jlsArgv}
+	if got := argv(runner.Commands); reflect.DeepEqual(got, want) == false {
+		t.Errorf("Stop ran %q, want %q", got, want)
+	}
+	if output.Forced == false {
+		t.Error("Output.Forced isn't set after jail -R")
+	}
+	if strings.Contains(output.Stderr, "exec.stop timed out") == false {
+		t.Errorf("Output.Stderr = %q, want what jail -r printed", output.Stderr)
+	}
+
+	written, _ := ioutil.ReadFile(confPath)
+	if strings.Contains(string(written), StopTimeoutLine+`"5";`) == false {
+		t.Errorf("jail.conf doesn't have the overridden stop timeout:\n%s", written)
+	}
+}
+
+func TestStopWithoutForceFails(t *testing.T) {
+	runner := &command.RecordingRunner{Results: map[string]command.RecordedResult{}}
+	h, cleanup := testHost(t, runner)
+	defer cleanup()
+	conf := createTestJail(t, h, "mash")
+
+	runner.Results["jail -f "+ConfPath(h, "mash")+" -r mash"] = command.RecordedResult{Err: fmt.Errorf("exit status 1")}
+
+	_, output, err := StopWithOutput(h, conf, StopOptions{})
+	if err == nil {
+		t.Error("Stop succeeded, want the jail -r failure")
+	}
+	if len(runner.Commands) != 1 || output.Forced {
+		t.Errorf("Stop ran %q, want only jail -r", argv(runner.Commands))
+	}
+}
+
+func TestDryRunStart(t *testing.T) {
+	h, cleanup := testHost(t, command.DryRunRunner{})
+	defer cleanup()
+	conf := createTestJail(t, h, "mash")
+
+	state, err := Start(h, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Running {
+		t.Errorf("Start in a dry run = %+v, want a jail which isn't running", state)
+	}
+	if _, err := os.Stat(ConfPath(h, "mash")); err != nil {
+		t.Errorf("The jail.conf wasn't written in a dry run: %s", err)
+	}
+}
@@ -0,0 +1,23 @@
+package jail
+
+import (
+	"github.com/altsrc-io/Jest/host"
+)
+
+/*
+	Start the jails flagged StartAtBoot, and the jails they depend on, with StartJails,
+	using the configs in JestDB. Jails which are already running are left alone, so it's
+	safe to run again.
+*/
+func Boot(h *host.Host) error {
+	var names []string
+	jails := Configs(h)
+	for j := range jails {
+		if jails[j].StartAtBoot {
+			names = append(names, jails[j].JailName)
+		}
+	}
+
+	_, err := StartJails(h, names)
+	return err
+}
@@ -0,0 +1,187 @@
+package jail
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/altsrc-io/Jest/host"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+	Jails are started and stopped from a jail.conf file Jest writes for each jail,
+	rather than passing the parameters on the command line, so nothing from the
+	Config is ever interpreted by a shell.
+*/
+
+const jailNameRegex = `^[A-Za-z0-9_\-]+$`
+
+func ValidateName(name string) error {
+	r, err := regexp.Compile(jailNameRegex)
+	if err != nil {
+		return err
+	}
+
+	if r.MatchString(name) == false {
+		return fmt.Errorf("The jail name " + name + " is not valid. The name should match the regex " + jailNameRegex)
+	}
+
+	return nil
+}
+
+func ConfPath(h *host.Host, name string) string {
+	return filepath.Join(h.JestDir, "jails", name+".conf")
+}
+
+/*
+	Quote a value for jail.conf. Backslashes, quotes and $ are escaped so the value is
+	taken literally, and newlines are refused since they would end the parameter.
+*/
+func quoteParam(value string) (string, error) {
+	if strings.ContainsAny(value, "\n\r\x00") {
+		return "", fmt.Errorf("Jail parameters can't contain newlines: %q", value)
+	}
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
+	return `"` + replacer.Replace(value) + `"`, nil
+}
+
+func isTrue(value string) bool {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// The StopTimeout is a whole number of seconds, or empty to use jail's own timeouts.
+func ValidateStopTimeout(timeout string) error {
+	if timeout == "" {
+		return nil
+	}
+
+	_, err := strconv.ParseUint(timeout, 10, 32)
+	if err != nil {
+		return fmt.Errorf("The stop timeout should be a whole number of seconds: %q", timeout)
+	}
+	return nil
+}
+
+// Render the jail.conf stanza for the jail.
+func RenderConf(jail Config) ([]byte, error) {
+	return renderConf(jail, false)
+}
+
+/*
+	When the jail is being stopped exec.timeout is set to the StopTimeout too, so a hung
+	exec.stop fails the stop rather than blocking it. It isn't set for starting, as the
+	timeout would apply to exec.start as well.
+*/
+func renderConf(jail Config, stopping bool) ([]byte, error) {
+	err := ValidateName(jail.JailName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ValidateStopTimeout(jail.StopTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	ipv4, err := ParseAddrs(jail.IPV4Addr, false)
+	if err != nil {
+		return nil, err
+	}
+	ipv6, err := ParseAddrs(jail.IPV6Addr, true)
+	if err != nil {
+		return nil, err
+	}
+
+	execTimeout := ""
+	if stopping {
+		execTimeout = jail.StopTimeout
+	}
+
+	params := []struct {
+		line  string
+		value string
+	}{
+		{AllowRawSocketsLine, jail.AllowRawSockets},
+		{AllowSetHostnameLine, jail.AllowSetHostname},
+		{AllowSysVIPCLine, jail.AllowSysVIPC},
+		{ConsoleLogLine, jail.ConsoleLog},
+		{HostnameLine, jail.Hostname},
+		{InterfaceLine, jail.Interface},
+		{IPV4ModeLine, jail.IPV4Mode},
+		{IPV4AddrLine, FormatAddrs(ipv4)},
+		{IPV6ModeLine, jail.IPV6Mode},
+		{IPV6AddrLine, FormatAddrs(ipv6)},
+		{JailUserLine, jail.JailUser},
+		{PathLine, jail.Path},
+		{SystemUserLine, jail.SystemUser},
+		{StartLine, jail.Start},
+		{StopLine, jail.Stop},
+		{StopTimeoutLine, jail.StopTimeout},
+		{ExecTimeoutLine, execTimeout},
+	}
+
+	var conf bytes.Buffer
+	conf.WriteString("# Written by Jest, changes will be overwritten.\n")
+	conf.WriteString(jail.JailName + " {\n")
+
+	if isTrue(jail.AllowMount) {
+		conf.WriteString("\t" + AllowMountLine + "\n")
+	}
+	if isTrue(jail.Clean) {
+		conf.WriteString("\t" + CleanLine + "\n")
+	}
+
+	for p := range params {
+		if params[p].value == "" {
+			continue
+		}
+
+		quoted, err := quoteParam(params[p].value)
+		if err != nil {
+			return nil, err
+		}
+		conf.WriteString("\t" + params[p].line + quoted + ";\n")
+	}
+
+	conf.WriteString("}\n")
+	return conf.Bytes(), nil
+}
+
+// Write the jail.conf for the jail under JestDir, returning its path.
+func WriteConf(h *host.Host, jail Config) (string, error) {
+	return writeConf(h, jail, false)
+}
+
+func writeConf(h *host.Host, jail Config, stopping bool) (string, error) {
+	conf, err := renderConf(jail, stopping)
+	if err != nil {
+		return "", err
+	}
+
+	path := ConfPath(h, jail.JailName)
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return "", err
+	}
+
+	log.WithFields(log.Fields{"fileName": path, "jail": jail.JailName}).Debug("Writing jail.conf.")
+	return path, ioutil.WriteFile(path, conf, 0600)
+}
+
+func RemoveConf(h *host.Host, name string) error {
+	err := os.Remove(ConfPath(h, name))
+	if err != nil && os.IsNotExist(err) == false {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package jail
+
+import (
+	"fmt"
+	"github.com/altsrc-io/Jest/host"
+	"github.com/altsrc-io/Jest/model"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+)
+
+// What happened to one jail when starting or stopping several, see model.JailStep.
+type Step = model.JailStep
+
+// Each group, and the names of the jails in it.
+func Groups(h *host.Host) map[string][]string {
+	groups := make(map[string][]string)
+	jails := Configs(h)
+	for j := range jails {
+		for _, group := range jails[j].Groups {
+			groups[group] = append(groups[group], jails[j].JailName)
+		}
+	}
+
+	for group := range groups {
+		sort.Strings(groups[group])
+	}
+	return groups
+}
+
+// Group names are used in URLs, so they're held to the same rules as jail names.
+func validateGroups(reqForm Config) error {
+	for _, group := range reqForm.Groups {
+		if ValidateName(group) != nil {
+			return &FieldError{"Groups", group, "", "The group name " + group + " is not valid. The name should match the regex " + jailNameRegex}
+		}
+	}
+	return nil
+}
+
+// The names which are in failed.
+func failedAmong(names []string, failed []string) []string {
+	var found []string
+	for _, name := range names {
+		if contains(failed, name) {
+			found = append(found, name)
+		}
+	}
+	return found
+}
+
+/*
+	Start the named jails, and the jails they depend on first, in StartOrder. Jails which
+	are already running are left alone. A jail which fails to start doesn't stop the rest,
+	but the jails which depend on it are skipped.
+*/
+func StartJails(h *host.Host, names []string) ([]Step, error) {
+	order, err := StartOrder(WithDependencies(Configs(h), names))
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := States(h)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []Step
+	var failed []string
+	for j := range order {
+		jail := order[j]
+		step := Step{Name: jail.JailName, State: FindState(jail.JailName, states)}
+		fields := log.Fields{"jail": jail.JailName, "priority": jail.BootPriority}
+
+		if step.State.Running {
+			log.WithFields(fields).Info("The jail is already running.")
+			steps = append(steps, step)
+			continue
+		}
+
+		if failedDeps := failedAmong(jail.Depends, failed); len(failedDeps) > 0 {
+			log.WithFields(fields).Warn("Not starting the jail, as the jails it depends on didn't start: " + strings.Join(failedDeps, ", "))
+			step.Skipped = true
+			failed = append(failed, jail.JailName)
+			steps = append(steps, step)
+			continue
+		}
+
+		log.WithFields(fields).Info("Starting the jail.")
+		step.Action = "start"
+		step.State, step.Output, err = StartWithOutput(h, jail)
+		if err != nil {
+			log.WithFields(log.Fields{"jail": jail.JailName, "error": err, "stdout": step.Output.Stdout, "stderr": step.Output.Stderr, "consoleLog": step.Output.ConsoleLog}).Warn("Couldn't start the jail.")
+			step.Error = err.Error()
+			failed = append(failed, jail.JailName)
+		}
+		steps = append(steps, step)
+	}
+
+	if len(failed) > 0 {
+		return steps, fmt.Errorf("Couldn't start the jails: " + strings.Join(failed, ", "))
+	}
+	return steps, nil
+}
+
+/*
+	Stop the named jails, and the jails which depend on them first, in the reverse of
+	their StartOrder. Jails which aren't running are left alone. A jail which fails to
+	stop doesn't stop the rest, but the jails it depends on are left running.
+*/
+func StopJails(h *host.Host, names []string, opts StopOptions) ([]Step, error) {
+	order, err := StartOrder(WithDependents(Configs(h), names))
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := States(h)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []Step
+	var failed []string
+	for j := len(order) - 1; j >= 0; j-- {
+		jail := order[j]
+		step := Step{Name: jail.JailName, State: FindState(jail.JailName, states)}
+		fields := log.Fields{"jail": jail.JailName}
+
+		if step.State.Running == false {
+			steps = append(steps, step)
+			continue
+		}
+
+		var failedDependents []string
+		for _, name := range failed {
+			if contains(FindConfig(order, name).Depends, jail.JailName) {
+				failedDependents = append(failedDependents, name)
+			}
+		}
+		if len(failedDependents) > 0 {
+			log.WithFields(fields).Warn("Not stopping the jail, as the jails which depend on it didn't stop: " + strings.Join(failedDependents, ", "))
+			step.Skipped = true
+			failed = append(failed, jail.JailName)
+			steps = append(steps, step)
+			continue
+		}
+
+		log.WithFields(fields).Info("Stopping the jail.")
+		step.Action = "stop"
+		step.State, step.Output, err = StopWithOutput(h, jail, opts)
+		if err != nil {
+			log.WithFields(log.Fields{"jail": jail.JailName, "error": err, "stdout": step.Output.Stdout, "stderr": step.Output.Stderr, "consoleLog": step.Output.ConsoleLog}).Warn("Couldn't stop the jail.")
+			step.Error = err.Error()
+			failed = append(failed, jail.JailName)
+		}
+		steps = append(steps, step)
+	}
+
+	if len(failed) > 0 {
+		return steps, fmt.Errorf("Couldn't stop the jails: " + strings.Join(failed, ", "))
+	}
+	return steps, nil
+}
+
+/*
+	Stop the named jails and the jails which depend on them, then start them again along
+	with the dependents which were running.
+*/
+func RestartJails(h *host.Host, names []string, opts StopOptions) ([]Step, error) {
+	steps, err := StopJails(h, names, opts)
+	if err != nil {
+		return steps, err
+	}
+
+	start := append([]string{}, names...)
+	for s := range steps {
+		if steps[s].Action == "stop" && contains(start, steps[s].Name) == false {
+			start = append(start, steps[s].Name)
+		}
+	}
+
+	started, err := StartJails(h, start)
+	return append(steps, started...), err
+}
+
+/*
+	Every jail the action, start, stop or restart, touches when it's run on the named jails
+	with their dependencies, along with the named jails. A restart stops the jails which
+	depend on them and starts those again, with the jails they depend on.
+*/
+func Affected(jails []Config, names []string, action string) []Config {
+	switch action {
+	case "start":
+		return WithDependencies(jails, names)
+	case "stop":
+		return WithDependents(jails, names)
+	}
+
+	dependents := WithDependents(jails, names)
+	restarted := make([]string, len(dependents))
+	for d := range dependents {
+		restarted[d] = dependents[d].JailName
+	}
+	return WithDependencies(jails, restarted)
+}
+
+// Find a config by the jail's name, a jail which isn't found has an empty config.
+func FindConfig(jails []Config, name string) Config {
+	for j := range jails {
+		if jails[j].JailName == name {
+			return jails[j]
+		}
+	}
+	return Config{}
+}
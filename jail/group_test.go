@@ -0,0 +1,134 @@
+package jail
+
+import (
+	"github.com/altsrc-io/Jest/command"
+	"reflect"
+	"testing"
+)
+
+func TestGroups(t *testing.T) {
+	h, cleanup := testHost(t, &command.RecordingRunner{})
+	defer cleanup()
+
+	createJails(t, h,
+		Config{JailName: "web", Groups: []string{"frontend", "prod"}},
+		Config{JailName: "db", Groups: []string{"prod"}},
+		Config{JailName: "app", Groups: []string{"prod"}},
+		Config{JailName: "scratch"},
+	)
+
+	want := map[string][]string{
+		"frontend": {"web"},
+		"prod":     {"app", "db", "web"},
+	}
+	if got := Groups(h); reflect.DeepEqual(got, want) == false {
+		t.Errorf("Groups() = %v, want %v", got, want)
+	}
+}
+
+/*
+	proxy -> app -> db
+	           \--> cache
+	batch -> db
+	scratch
+*/
+var dependencyJails = []Config{
+	{JailName: "app", Depends: []string{"db", "cache"}},
+	{JailName: "batch", Depends: []string{"db"}},
+	{JailName: "cache"},
+	{JailName: "db"},
+	{JailName: "proxy", Depends: []string{"app"}},
+	{JailName: "scratch"},
+}
+
+func TestWithDependencies(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  []string
+	}{
+		{[]string{"db"}, []string{"db"}},
+		{[]string{"app"}, []string{"app", "cache", "db"}},
+		{[]string{"proxy"}, []string{"app", "cache", "db", "proxy"}},
+		{[]string{"proxy", "batch"}, []string{"app", "batch", "cache", "db", "proxy"}},
+		{[]string{"scratch", "missing"}, []string{"scratch"}},
+	}
+	for _, test := range tests {
+		if got := names(WithDependencies(dependencyJails, test.names)); reflect.DeepEqual(got, test.want) == false {
+			t.Errorf("WithDependencies(%v) = %v, want %v", test.names, got, test.want)
+		}
+	}
+}
+
+func TestWithDependents(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  []string
+	}{
+		{[]string{"proxy"}, []string{"proxy"}},
+		{[]string{"cache"}, []string{"app", "cache", "proxy"}},
+		{[]string{"db"}, []string{"app", "batch", "db", "proxy"}},
+		{[]string{"scratch", "missing"}, []string{"scratch"}},
+	}
+	for _, test := range tests {
+		if got := names(WithDependents(dependencyJails, test.names)); reflect.DeepEqual(got, test.want) == false {
+			t.Errorf("WithDependents(%v) = %v, want %v", test.names, got, test.want)
+		}
+	}
+}
+
+func TestAffected(t *testing.T) {
+	tests := []struct {
+		action string
+		names  []string
+		want   []string
+	}{
+		{"start", []string{"app"}, []string{"app", "cache", "db"}},
+		{"stop", []string{"cache"}, []string{"app", "cache", "proxy"}},
+		// Restarting the cache restarts app and proxy, which start db again too.
+		{"restart", []string{"cache"}, []string{"app", "cache", "db", "proxy"}},
+	}
+	for _, test := range tests {
+		if got := names(Affected(dependencyJails, test.names, test.action)); reflect.DeepEqual(got, test.want) == false {
+			t.Errorf("Affected(%v, %s) = %v, want %v", test.names, test.action, got, test.want)
+		}
+	}
+}
+
+func TestStopJailsInReverseOrder(t *testing.T) {
+	runner := &command.RecordingRunner{Results: map[string]command.RecordedResult{}}
+	h, cleanup := testHost(t, runner)
+	defer cleanup()
+
+	createJails(t, h,
+		Config{JailName: "proxy", Depends: []string{"app"}},
+		Config{JailName: "app", Depends: []string{"db"}},
+		Config{JailName: "db"},
+		Config{JailName: "batch", Depends: []string{"db"}},
+		Config{JailName: "scratch"},
+	)
+	runner.Results["jls -d -v --libxo json"] = command.RecordedResult{Stdout: `{"__version": "2", "jail-information": {"jail": [
+		{"jid": 1, "name": "db", "state": "ACTIVE"},
+		{"jid": 2, "name": "app", "state": "ACTIVE"},
+		{"jid": 3, "name": "proxy", "state": "ACTIVE"},
+		{"jid": 4, "name": "scratch", "state": "ACTIVE"}
+	]}}`}
+
+	steps, err := StopJails(h, []string{"db"}, StopOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The jails which depend on db stop first, batch isn't running and scratch is left alone.
+	want := []string{"proxy", "app", "db"}
+	if got := jailsActedOn(runner.Commands, "-r"); reflect.DeepEqual(got, want) == false {
+		t.Errorf("StopJails(db) stopped %v, want %v", got, want)
+	}
+
+	var stepped []string
+	for s := range steps {
+		stepped = append(stepped, steps[s].Name+":"+steps[s].Action)
+	}
+	if want := []string{"proxy:stop", "batch:", "app:stop", "db:stop"}; reflect.DeepEqual(stepped, want) == false {
+		t.Errorf("StopJails(db) steps = %v, want %v", stepped, want)
+	}
+}
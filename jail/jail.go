@@ -0,0 +1,402 @@
+/*
+	Package jail creates, starts, stops and deletes the jails. Each jail is cloned from
+	its template's Ready snapshot into <dataset>/<name>, and its Config is kept in JestDB.
+*/
+package jail
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/host"
+	"github.com/altsrc-io/Jest/model"
+	"github.com/altsrc-io/Jest/store"
+	"github.com/altsrc-io/Jest/template"
+	"github.com/boltdb/bolt"
+	"github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+)
+
+// The types the API sends, defined in the model package so the client can use them without this one.
+type (
+	Jail   = model.Jail
+	Config = model.JailConfig
+	State  = model.JailState
+)
+
+const ( // = example line:
+	AllowRawSocketsLine  = `allow.raw_sockets = `  // allow.raw_sockets = 0;
+	AllowMountLine       = `allow.mount;`          // allow.mount;
+	AllowSetHostnameLine = `allow.set_hostname = ` // allow.set_hostname = 0;
+	AllowSysVIPCLine     = `allow.sysvipc = `      // allow.sysvipc = 0;
+	CleanLine            = `exec.clean;`           // exec.clean;
+	ConsoleLogLine       = `exec.consolelog = `    // exec.consolelog = "/var/log/jail_${name}_console.log";
+	HostnameLine         = `host.hostname = `      // host.hostname = "pie.local";
+	InterfaceLine        = `interface = `          // interface = "em0";
+	IPV4AddrLine         = `ip4.addr = `           // ip4.addr = "em0|10.0.2.12/24,10.0.2.13";
+	IPV4ModeLine         = `ip4 = `                // ip4 = "inherit";
+	IPV6AddrLine         = `ip6.addr = `           // ip6.addr = "2001:db8::12";
+	IPV6ModeLine         = `ip6 = `                // ip6 = "new";
+	JailUserLine         = `exec.jail_user = `     // exec.jail_user = "root";
+	PathLine             = `path = `               // path = "/usr/jail/${name}";
+	SystemUserLine       = `exec.system_user = `   // exec.system_user = "root";
+	StartLine            = `exec.start += `        // exec.start += "/bin/sh /etc/rc";
+	StopLine             = `exec.stop = `          // exec.stop = "/bin/sh /etc/rc.shutdown";
+	StopTimeoutLine      = `stop.timeout = `       // stop.timeout = "30";
+	ExecTimeoutLine      = `exec.timeout = `       // exec.timeout = "30";
+)
+
+// Jails are cloned from their template into <dataset>/<name>.
+func DatasetName(h *host.Host, name string) string {
+	return h.Conf.JestDataset + "/" + name
+}
+
+/*
+	A field of a jail's config which isn't valid. Jail is set when the value is already
+	used by that jail, rather than not being allowed at all.
+*/
+type FieldError struct {
+	Field  string
+	Value  string
+	Jail   string
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return e.Reason
+}
+
+// Check the addresses, that the hostname, name and IPs aren't used by another jail, and the template can be cloned.
+func Validate(h *host.Host, reqForm Config) error {
+	err := validateNetwork(reqForm)
+	if err != nil {
+		return err
+	}
+
+	err = validateUnique(h, reqForm, "")
+	if err != nil {
+		return err
+	}
+
+	err = ValidateStopTimeout(reqForm.StopTimeout)
+	if err != nil {
+		return &FieldError{"StopTimeout", reqForm.StopTimeout, "", err.Error()}
+	}
+
+	err = validateDepends(h, reqForm)
+	if err != nil {
+		return err
+	}
+
+	err = validateGroups(reqForm)
+	if err != nil {
+		return err
+	}
+
+	templates := template.List(h)
+
+	for j := range templates {
+		if templates[j].Name == reqForm.Template {
+			if templates[j].Disabled {
+				return &FieldError{"Template", reqForm.Template, "", "Template is disabled: " + reqForm.Template}
+			}
+			return nil
+		}
+	}
+
+	return &FieldError{"Template", reqForm.Template, "", "Invalid template: " + reqForm.Template}
+}
+
+// Check no jail but the one named exclude uses the hostname, name or IPs, or a prefix overlapping one.
+func validateUnique(h *host.Host, reqForm Config, exclude string) error {
+	return h.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.JailsBucket)
+
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			encoded := bytes.NewReader(v)
+			form := Config{}
+			err := json.NewDecoder(encoded).Decode(&form)
+			if err != nil {
+				log.Warn("Couldn't decode a key:", err)
+			}
+
+			switch {
+			case exclude != "" && form.JailName == exclude:
+				continue
+			case form.Hostname == reqForm.Hostname:
+				return &FieldError{"Hostname", reqForm.Hostname, form.JailName, "Hostname already in use: " + reqForm.Hostname + "."}
+			case form.JailName == reqForm.JailName:
+				return &FieldError{"JailName", reqForm.JailName, form.JailName, "Jail name already in use: " + reqForm.JailName + "."}
+			}
+
+			if field, mine, used, ok := overlappingAddr(reqForm, form); ok {
+				if mine.IP.Equal(used.IP) {
+					return &FieldError{field, mine.String(), form.JailName, "IP address already in use: " + mine.String() + "."}
+				}
+				return &FieldError{field, mine.String(), form.JailName, "IP address " + mine.String() + " overlaps " + used.String() + "."}
+			}
+		}
+
+		return nil
+	})
+}
+
+// The config the jail gets if it's created with UseDefaults, from the host's JailDefaults.
+func WithDefaults(h *host.Host, form Config) Config {
+	return Config{
+		AllowRawSockets:  h.Conf.JailDefaults.AllowRawSockets,
+		AllowMount:       h.Conf.JailDefaults.AllowMount,
+		AllowSetHostname: h.Conf.JailDefaults.AllowSetHostname,
+		AllowSysVIPC:     h.Conf.JailDefaults.AllowSysVIPC,
+		Clean:            h.Conf.JailDefaults.Clean,
+		ConsoleLog:       `/var/log/jail_` + form.JailName + `_console.log`,
+		Hostname:         form.Hostname,
+		Interface:        form.Interface,
+		IPV4Addr:         form.IPV4Addr,
+		IPV4Mode:         form.IPV4Mode,
+		IPV6Addr:         form.IPV6Addr,
+		IPV6Mode:         form.IPV6Mode,
+		JailUser:         h.Conf.JailDefaults.JailUser,
+		JailName:         form.JailName,
+		Path:             filepath.Join(h.Conf.JestDir, form.JailName),
+		SystemUser:       h.Conf.JailDefaults.SystemUser,
+		Start:            h.Conf.JailDefaults.Start,
+		Stop:             h.Conf.JailDefaults.Stop,
+		StopTimeout:      h.Conf.JailDefaults.StopTimeout,
+		Template:         form.Template,
+		UseDefaults:      form.UseDefaults,
+		StartAtBoot:      form.StartAtBoot,
+		BootPriority:     form.BootPriority,
+		Depends:          form.Depends,
+		Groups:           form.Groups,
+	}
+}
+
+/*
+	Create the jail under the UUID the request was given: clone its template's Ready
+	snapshot into <dataset>/<name>, then record its config, with the clone's mountpoint
+	as its Path, and who owns it. The config is only recorded once the clone exists, and
+	the clone is destroyed again if it can't be, so a failed create doesn't leave the name
+	taken. The form should already have passed Validate.
+*/
+func Create(h *host.Host, jUID string, form Config, owner string) error {
+	key, err := uuid.FromString(jUID)
+	if err != nil {
+		return err
+	}
+
+	record := form
+	if form.UseDefaults == true {
+		record = WithDefaults(h, form)
+	}
+	// The jail runs in its clone, whatever Path the request gave.
+	record.Path = filepath.Join(h.Conf.JestDir, form.JailName)
+
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "jUID": jUID}).Warn("Failed to encode the struct to JSON before writing to the JestDB.")
+		return err
+	}
+
+	// ToDo: We are basically validating the template twice, clean this up...
+	t, _ := template.Find(form.Template, template.List(h))
+	log.WithFields(log.Fields{"template": t.Name, "dataset": t.ZFSParams.Name}).Debug("Finding the template's snapshot.")
+	snapshot, err := h.FindZFSSnapshot(t.ZFSParams.Name + "/." + t.Name)
+	if err != nil {
+		return err
+	}
+
+	opts := make(map[string]string)
+	opts["mountpoint"] = record.Path
+	if t.ZFSParams.Compression {
+		opts["compression"] = "on"
+	}
+
+	dataset := DatasetName(h, form.JailName)
+	_, err = h.CloneZFSSnapshot(snapshot, dataset, opts)
+	if err != nil {
+		return fmt.Errorf("Couldn't clone the template snapshot: %s", err)
+	}
+
+	err = h.DB.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(store.JailsBucket).Put(key.Bytes(), encoded)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(store.OwnersBucket).Put([]byte(form.JailName), []byte(owner))
+	})
+	if err != nil {
+		log.WithFields(log.Fields{"dataset": dataset, "jUID": jUID}).Warn("Destroying the jail's dataset, as its config couldn't be recorded.")
+		destroyErr := h.DestroyZFSDataset(dataset, true)
+		if destroyErr != nil {
+			log.WithFields(log.Fields{"dataset": dataset, "error": destroyErr}).Warn("Failed to destroy the jail's dataset.")
+		}
+		return fmt.Errorf("Couldn't record the jail: %s", err)
+	}
+
+	return nil
+}
+
+// The stored config of every jail, without asking jls for their state.
+func Configs(h *host.Host) []Config {
+	var jailConfig = []Config{}
+
+	h.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.JailsBucket)
+
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			encoded := bytes.NewReader(v)
+			form := Config{}
+			err := json.NewDecoder(encoded).Decode(&form)
+			if err != nil {
+				log.Warn("Couldn't decode a key:", err)
+			}
+
+			jailConfig = append(jailConfig, form)
+
+		}
+		return nil
+	})
+
+	return jailConfig
+}
+
+// ToDo: Add error handling here
+func List(h *host.Host) []Jail {
+	var jailConfig = Configs(h)
+	var jail = []Jail{}
+
+	// Only ask jls once for all of the jails.
+	states, err := States(h)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Warn("Couldn't get the state of the jails.")
+	}
+
+	owners := Owners(h)
+
+	for j := range jailConfig {
+		jailStatus := FindState(jailConfig[j].JailName, states)
+		jail = append(jail, Jail{Name: jailConfig[j].JailName, JailConfig: jailConfig[j], JailState: jailStatus, Owner: owners[jailConfig[j].JailName]})
+	}
+	return jail
+}
+
+func GetConfig(h *host.Host, name string) (Config, error) {
+	jails := List(h)
+
+	for j := range jails {
+		if jails[j].JailConfig.JailName == name {
+			return jails[j].JailConfig, nil
+		}
+	}
+
+	return Config{}, fmt.Errorf("Couldn't find the jail " + name + ".")
+}
+
+// Overwrite the stored config of the jail with the given name, keeping its key.
+func UpdateConfig(h *host.Host, name string, jail Config) error {
+	encoded, err := json.Marshal(jail)
+	if err != nil {
+		return err
+	}
+
+	return h.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.JailsBucket)
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			form := Config{}
+			err := json.NewDecoder(bytes.NewReader(v)).Decode(&form)
+			if err != nil {
+				log.Warn("Couldn't decode a key:", err)
+			}
+
+			if form.JailName == name {
+				return b.Put(k, encoded)
+			}
+		}
+
+		return fmt.Errorf("There are no jails with the name " + name + " to update.")
+	})
+}
+
+func Status(h *host.Host, jail Config) (State, error) {
+	states, err := States(h)
+	if err != nil {
+		return State{Name: jail.JailName}, err
+	}
+
+	return FindState(jail.JailName, states), nil
+}
+
+// Remove the jail's console log, if it has one.
+func RemoveConsoleLog(jail Config) error {
+	if jail.ConsoleLog == "" {
+		return nil
+	}
+
+	log.WithFields(log.Fields{"fileName": jail.ConsoleLog}).Debug("Removing the jail's console log.")
+	err := os.Remove(jail.ConsoleLog)
+	if err != nil && os.IsNotExist(err) == false {
+		return err
+	}
+	return nil
+}
+
+// Remove the jail and its owner from the DB, once everything else about it has been removed.
+func DeleteRecord(h *host.Host, name string) error {
+	return h.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.JailsBucket)
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			encoded := bytes.NewReader(v)
+			form := Config{}
+			err := json.NewDecoder(encoded).Decode(&form)
+			if err != nil {
+				log.Warn("Couldn't decode a key:", err)
+			}
+
+			if form.JailName == name {
+				err := b.Delete(k)
+				if err != nil {
+					return err
+				}
+				return tx.Bucket(store.OwnersBucket).Delete([]byte(name))
+			}
+		}
+
+		return fmt.Errorf("There are no jails with the name " + name + " to delete.")
+	})
+}
+
+// Return the names of the jails that were cloned from the template.
+func ClonedFrom(h *host.Host, template string) []string {
+	var jails []string
+
+	h.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.JailsBucket)
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			form := Config{}
+			err := json.NewDecoder(bytes.NewReader(v)).Decode(&form)
+			if err != nil {
+				log.Warn("Couldn't decode a key:", err)
+			}
+
+			if form.Template == template {
+				jails = append(jails, form.JailName)
+			}
+		}
+		return nil
+	})
+
+	return jails
+}
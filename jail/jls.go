@@ -0,0 +1,100 @@
+package jail
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/host"
+	"strconv"
+	"strings"
+)
+
+/*
+	The jls binary used to find the running jails. It can be pointed at a fake jls
+	which prints canned output, so the parsing can be tested without jails.
+*/
+var JlsCommand = "jls"
+
+/*
+	The output of jls -d -v --libxo json:
+	{"__version": "2", "jail-information": {"jail": [{"jid": 1, "name": "mash", "state": "ACTIVE", ...}]}}
+*/
+type jlsOutput struct {
+	JailInformation struct {
+		Jail []jlsJail `json:"jail"`
+	} `json:"jail-information"`
+}
+
+type jlsJail struct {
+	JID       json.Number `json:"jid"`
+	Name      string      `json:"name"`
+	Hostname  string      `json:"hostname"`
+	Path      string      `json:"path"`
+	State     string      `json:"state"`
+	IPV4      string      `json:"ipv4"` // Only in the non-verbose output
+	IPV4Addrs []string    `json:"ipv4_addrs"`
+	IPV6Addrs []string    `json:"ipv6_addrs"`
+}
+
+func parseJls(out []byte) ([]State, error) {
+	var parsed jlsOutput
+	states := []State{}
+
+	// A dry run doesn't run jls at all.
+	if len(bytes.TrimSpace(out)) == 0 {
+		return states, nil
+	}
+
+	err := json.Unmarshal(out, &parsed)
+	if err != nil {
+		return states, fmt.Errorf("Couldn't parse the output of jls: %s", err)
+	}
+
+	for j := range parsed.JailInformation.Jail {
+		jail := parsed.JailInformation.Jail[j]
+
+		jid, err := strconv.Atoi(jail.JID.String())
+		if err != nil {
+			return states, fmt.Errorf("jls returned an invalid JID for the jail %s: %s", jail.Name, jail.JID)
+		}
+
+		ipv4 := jail.IPV4Addrs
+		if len(ipv4) == 0 && jail.IPV4 != "" && jail.IPV4 != "-" {
+			ipv4 = []string{jail.IPV4}
+		}
+
+		dying := strings.EqualFold(jail.State, "DYING")
+		states = append(states, State{
+			Name:      jail.Name,
+			Running:   dying == false,
+			JID:       strconv.Itoa(jid),
+			Path:      jail.Path,
+			Hostname:  jail.Hostname,
+			IPV4Addrs: ipv4,
+			IPV6Addrs: jail.IPV6Addrs,
+			Dying:     dying,
+		})
+	}
+
+	return states, nil
+}
+
+// List every jail on the host, including the dying ones.
+func States(h *host.Host) ([]State, error) {
+	out, err := h.RunCommand(nil, JlsCommand, "-d", "-v", "--libxo", "json")
+	if err != nil {
+		return []State{}, err
+	}
+
+	return parseJls([]byte(out))
+}
+
+// Find the state of the jail by its exact name, a jail which isn't found isn't running.
+func FindState(name string, states []State) State {
+	for s := range states {
+		if states[s].Name == name {
+			return states[s]
+		}
+	}
+	return State{Name: name}
+}
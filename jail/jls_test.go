@@ -0,0 +1,112 @@
+package jail
+
+import (
+	"github.com/altsrc-io/Jest/command"
+	"github.com/altsrc-io/Jest/host"
+	"github.com/altsrc-io/Jest/zfs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+/*
+	Point JlsCommand at a fake jls which prints the output and exits with the status.
+	Call the returned func to put the real jls back.
+*/
+func fakeJls(t *testing.T, output string, status int) (*host.Host, func()) {
+	dir, err := ioutil.TempDir("", "jest-jls")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "output.json"), []byte(output), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script := "#!/bin/sh\ncat '" + filepath.Join(dir, "output.json") + "'\nexit " + strconv.Itoa(status) + "\n"
+	err = ioutil.WriteFile(filepath.Join(dir, "jls"), []byte(script), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := JlsCommand
+	JlsCommand = filepath.Join(dir, "jls")
+	restore := func() {
+		JlsCommand = previous
+		os.RemoveAll(dir)
+	}
+
+	return host.New(zfs.NewMemoryStorage("zroot"), command.ExecRunner{}), restore
+}
+
+func TestStatesRunningJail(t *testing.T) {
+	h, restore := fakeJls(t, `{"__version": "2", "jail-information": {"jail": [
+		{"jid": 1, "name": "mash", "hostname": "mash.local", "path": "/usr/jail/mash", "state": "ACTIVE", "ipv4_addrs": ["10.0.2.12"], "ipv6_addrs": ["2001:db8::12"]},
+		{"jid": 2, "name": "pie", "hostname": "pie.local", "path": "/usr/jail/pie", "state": "DYING", "ipv4_addrs": []}
+	]}}`, 0)
+	defer restore()
+
+	states, err := States(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []State{
+		{Name: "mash", Running: true, JID: "1", Path: "/usr/jail/mash", Hostname: "mash.local", IPV4Addrs: []string{"10.0.2.12"}, IPV6Addrs: []string{"2001:db8::12"}},
+		{Name: "pie", Running: false, JID: "2", Path: "/usr/jail/pie", Hostname: "pie.local", IPV4Addrs: []string{}, Dying: true},
+	}
+	if reflect.DeepEqual(states, want) == false {
+		t.Errorf("States() = %+v, want %+v", states, want)
+	}
+
+	if found := FindState("mash", states); found.Running == false || found.JID != "1" {
+		t.Errorf("FindState(mash) = %+v, want the running jail", found)
+	}
+	if found := FindState("gravy", states); found.Running || found.Name != "gravy" {
+		t.Errorf("FindState(gravy) = %+v, want a jail which isn't running", found)
+	}
+}
+
+func TestStatesNoJails(t *testing.T) {
+	h, restore := fakeJls(t, `{"__version": "2", "jail-information": {"jail": []}}`, 0)
+	defer restore()
+
+	states, err := States(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 0 {
+		t.Errorf("States() = %+v, want no jails", states)
+	}
+}
+
+func TestStatesMalformedOutput(t *testing.T) {
+	outputs := map[string]string{
+		"not JSON":    `jid name hostname`,
+		"truncated":   `{"__version": "2", "jail-information": {"jail": [{"jid": 1,`,
+		"invalid JID": `{"__version": "2", "jail-information": {"jail": [{"jid": "one", "name": "mash", "state": "ACTIVE"}]}}`,
+	}
+
+	for name, output := range outputs {
+		h, restore := fakeJls(t, output, 0)
+		states, err := States(h)
+		restore()
+		if err == nil {
+			t.Errorf("%s: States() = %+v, want an error", name, states)
+		}
+	}
+}
+
+func TestStatesJlsFails(t *testing.T) {
+	h, restore := fakeJls(t, `jls: unknown parameter`, 1)
+	defer restore()
+
+	_, err := States(h)
+	if err == nil {
+		t.Error("States() succeeded, want the jls failure")
+	}
+}
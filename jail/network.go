@@ -0,0 +1,219 @@
+package jail
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+/*
+	A jail's IPV4Addr and IPV6Addr are lists of addresses separated by commas, as in
+	jail(8). Each address can be given an interface to be added to and a prefix length,
+	e.g. "em0|10.0.2.12/24, 10.0.2.13".
+*/
+type Address struct {
+	Interface string
+	IP        net.IP
+	Net       *net.IPNet // The prefix the address is given, a single address without one
+}
+
+// The modes of IPV4Mode and IPV6Mode, as in jail(8). Empty leaves it to jail.
+const (
+	ModeNew     = "new"     // Only the jail's own addresses
+	ModeInherit = "inherit" // Every address on the host
+	ModeDisable = "disable" // No addresses of the family
+)
+
+// Interface names can have dots, for VLANs such as em0.100, unlike jail names.
+const interfaceNameRegex = `^[A-Za-z0-9_.\-]+$`
+
+func validateInterface(name string) error {
+	if regexp.MustCompile(interfaceNameRegex).MatchString(name) == false {
+		return fmt.Errorf("The interface name " + name + " is not valid. The name should match the regex " + interfaceNameRegex)
+	}
+	return nil
+}
+
+// The address as it's written in jail.conf, without the prefix length if it's a single address.
+func (a Address) String() string {
+	s := a.IP.String()
+	if ones, bits := a.Net.Mask.Size(); ones != bits {
+		s = fmt.Sprintf("%s/%d", a.IP, ones)
+	}
+
+	if a.Interface != "" {
+		return a.Interface + "|" + s
+	}
+	return s
+}
+
+func (a Address) single() bool {
+	ones, bits := a.Net.Mask.Size()
+	return ones == bits
+}
+
+/*
+	Whether the addresses can't both be given out: they're the same address, or they both
+	have a prefix and the prefixes overlap, as the host can only have one route for a
+	network. A single address inside another's prefix is fine, it's how extra addresses
+	on a network are aliased, e.g. 10.0.2.12/24 and then 10.0.2.13.
+*/
+func (a Address) Overlaps(b Address) bool {
+	if a.IP.Equal(b.IP) {
+		return true
+	}
+	if a.single() || b.single() {
+		return false
+	}
+	return a.Net.Contains(b.Net.IP) || b.Net.Contains(a.Net.IP)
+}
+
+/*
+	Parse a list of addresses of the family, IPv6 if v6 is set. An address without a
+	prefix length is a single address, /32 or /128.
+*/
+func ParseAddrs(value string, v6 bool) ([]Address, error) {
+	var addrs []Address
+	if strings.TrimSpace(value) == "" {
+		return addrs, nil
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		var addr Address
+
+		if parts := strings.SplitN(item, "|", 2); len(parts) == 2 {
+			addr.Interface = parts[0]
+			item = parts[1]
+			err := validateInterface(addr.Interface)
+			if err != nil {
+				return addrs, err
+			}
+		}
+
+		bits := 32
+		if v6 {
+			bits = 128
+		}
+
+		if strings.Contains(item, "/") {
+			ip, ipNet, err := net.ParseCIDR(item)
+			if err != nil {
+				return addrs, fmt.Errorf("%q isn't a valid address: %s", item, err)
+			}
+			addr.IP = ip
+			addr.Net = ipNet
+		} else {
+			addr.IP = net.ParseIP(item)
+			if addr.IP == nil {
+				return addrs, fmt.Errorf("%q isn't a valid address.", item)
+			}
+			addr.Net = &net.IPNet{IP: addr.IP, Mask: net.CIDRMask(bits, bits)}
+		}
+
+		if (addr.IP.To4() == nil) != v6 {
+			family := "an IPv4"
+			if v6 {
+				family = "an IPv6"
+			}
+			return addrs, fmt.Errorf("%q isn't %s address.", item, family)
+		}
+		if v6 == false {
+			addr.IP = addr.IP.To4()
+		}
+
+		addrs = append(addrs, addr)
+	}
+
+	return addrs, nil
+}
+
+// The addresses in the canonical form they're written to jail.conf and given to jail -m in.
+func FormatAddrs(addrs []Address) string {
+	var formatted []string
+	for a := range addrs {
+		formatted = append(formatted, addrs[a].String())
+	}
+	return strings.Join(formatted, ",")
+}
+
+type networkField struct {
+	addrField string
+	modeField string
+	addrs     string
+	mode      string
+	v6        bool
+}
+
+func networkFields(jail Config) []networkField {
+	return []networkField{
+		{"IPV4Addr", "IPV4Mode", jail.IPV4Addr, jail.IPV4Mode, false},
+		{"IPV6Addr", "IPV6Mode", jail.IPV6Addr, jail.IPV6Mode, true},
+	}
+}
+
+/*
+	Check the jail's addresses can be parsed and don't overlap each other, that they're
+	only given with the new mode, and that the jail has some network: an address, or a
+	mode set explicitly.
+*/
+func validateNetwork(reqForm Config) error {
+	if reqForm.Interface != "" {
+		err := validateInterface(reqForm.Interface)
+		if err != nil {
+			return &FieldError{"Interface", reqForm.Interface, "", err.Error()}
+		}
+	}
+
+	var all []Address
+	for _, f := range networkFields(reqForm) {
+		switch f.mode {
+		case "", ModeNew:
+		case ModeInherit, ModeDisable:
+			if f.addrs != "" {
+				return &FieldError{f.addrField, f.addrs, "", "A jail can only be given addresses with the " + ModeNew + " mode, not " + f.mode + "."}
+			}
+		default:
+			return &FieldError{f.modeField, f.mode, "", "The mode should be " + ModeNew + ", " + ModeInherit + " or " + ModeDisable + "."}
+		}
+
+		addrs, err := ParseAddrs(f.addrs, f.v6)
+		if err != nil {
+			return &FieldError{f.addrField, f.addrs, "", err.Error()}
+		}
+		for a := range addrs {
+			for b := range all {
+				if addrs[a].Overlaps(all[b]) {
+					return &FieldError{f.addrField, addrs[a].String(), "", "The jail's addresses " + addrs[a].String() + " and " + all[b].String() + " overlap."}
+				}
+			}
+			all = append(all, addrs[a])
+		}
+	}
+
+	if len(all) == 0 && reqForm.IPV4Mode == "" && reqForm.IPV6Mode == "" {
+		return &FieldError{"IPV4Addr", "", "", "The jail must have an IP address, or an IPV4Mode or IPV6Mode."}
+	}
+	return nil
+}
+
+/*
+	Find an address of the config which overlaps an address of the other jail's config,
+	returning the field and the two addresses.
+*/
+func overlappingAddr(reqForm Config, other Config) (string, Address, Address, bool) {
+	theirs := networkFields(other)
+	for i, f := range networkFields(reqForm) {
+		mine, _ := ParseAddrs(f.addrs, f.v6)
+		used, _ := ParseAddrs(theirs[i].addrs, f.v6)
+		for a := range mine {
+			for b := range used {
+				if mine[a].Overlaps(used[b]) {
+					return f.addrField, mine[a], used[b], true
+				}
+			}
+		}
+	}
+	return "", Address{}, Address{}, false
+}
@@ -0,0 +1,166 @@
+package jail
+
+import (
+	"github.com/altsrc-io/Jest/command"
+	"testing"
+)
+
+func TestParseAddrs(t *testing.T) {
+	tests := []struct {
+		value string
+		v6    bool
+		want  string // The addresses as FormatAddrs writes them, if they're valid
+		valid bool
+	}{
+		{"", false, "", true},
+		{"10.0.2.12", false, "10.0.2.12", true},
+		{"10.0.2.12/32", false, "10.0.2.12", true},
+		{"10.0.2.12/24", false, "10.0.2.12/24", true},
+		{" em0|10.0.2.12/24 , 10.0.2.13", false, "em0|10.0.2.12/24,10.0.2.13", true},
+		{"em0.100|10.0.2.12", false, "em0.100|10.0.2.12", true},
+		{"2001:db8::12", true, "2001:db8::12", true},
+		{"2001:db8::12/64, em0|2001:db8::13", true, "2001:db8::12/64,em0|2001:db8::13", true},
+		{"2001:DB8:0:0::12", true, "2001:db8::12", true},
+
+		{"10.0.2", false, "", false},
+		{"10.0.2.256", false, "", false},
+		{"10.0.2.12/33", false, "", false},
+		{"10.0.2.12,", false, "", false},
+		{"em 0|10.0.2.12", false, "", false},
+		{"2001:db8::12", false, "", false}, // IPv6 in IPV4Addr
+		{"10.0.2.12", true, "", false},     // IPv4 in IPV6Addr
+		{"2001:db8::12/129", true, "", false},
+	}
+
+	for _, test := range tests {
+		addrs, err := ParseAddrs(test.value, test.v6)
+		switch {
+		case test.valid && err != nil:
+			t.Errorf("ParseAddrs(%q, %t) = %s, want %q", test.value, test.v6, err, test.want)
+		case test.valid == false && err == nil:
+			t.Errorf("ParseAddrs(%q, %t) = %q, want an error", test.value, test.v6, FormatAddrs(addrs))
+		case test.valid && FormatAddrs(addrs) != test.want:
+			t.Errorf("ParseAddrs(%q, %t) = %q, want %q", test.value, test.v6, FormatAddrs(addrs), test.want)
+		}
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		v6       bool
+		overlaps bool
+	}{
+		{"10.0.2.12", "10.0.2.12", false, true},
+		{"10.0.2.12", "10.0.2.13", false, false},
+		{"10.0.2.12/24", "10.0.2.12", false, true},      // The same address, whatever the prefix
+		{"em0|10.0.2.12", "em1|10.0.2.12", false, true}, // Or the interface
+		{"10.0.2.12/24", "10.0.2.200/24", false, true},
+		{"10.0.2.12/24", "10.0.0.1/16", false, true},
+		{"10.0.2.12/24", "10.0.3.12/24", false, false},
+		// A single address inside another's prefix is allowed, it's how aliases on a network are added.
+		{"10.0.2.12/24", "10.0.2.13", false, false},
+		{"10.0.2.13", "10.0.2.12/24", false, false},
+
+		{"2001:db8::12", "2001:db8::12", true, true},
+		{"2001:db8::12", "2001:db8::13", true, false},
+		{"2001:db8::12/64", "2001:db8::ffff/64", true, true},
+		{"2001:db8::12/64", "2001:db8:1::12/64", true, false},
+		{"2001:db8::12/64", "2001:db8::13", true, false},
+	}
+
+	for _, test := range tests {
+		a, err := ParseAddrs(test.a, test.v6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ParseAddrs(test.b, test.v6)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := a[0].Overlaps(b[0]); got != test.overlaps {
+			t.Errorf("%s overlaps %s = %t, want %t", test.a, test.b, got, test.overlaps)
+		}
+		if got := b[0].Overlaps(a[0]); got != test.overlaps {
+			t.Errorf("%s overlaps %s = %t, want %t", test.b, test.a, got, test.overlaps)
+		}
+	}
+}
+
+func TestValidateNetwork(t *testing.T) {
+	tests := []struct {
+		form  Config
+		field string // The field of the FieldError, or empty if the form is valid
+	}{
+		{Config{IPV4Addr: "10.0.2.12"}, ""},
+		{Config{IPV6Addr: "2001:db8::12"}, ""},
+		{Config{IPV4Addr: "10.0.2.12/24,10.0.2.13", IPV6Addr: "2001:db8::12/64"}, ""},
+		{Config{IPV4Mode: ModeInherit}, ""},
+		{Config{IPV4Addr: "10.0.2.12", IPV6Mode: ModeDisable}, ""},
+		{Config{Interface: "em0", IPV4Addr: "10.0.2.12"}, ""},
+
+		{Config{}, "IPV4Addr"},
+		{Config{IPV4Addr: "10.0.2.12,10.0.2.12"}, "IPV4Addr"},
+		{Config{IPV4Addr: "10.0.2.12/24,10.0.2.200/24"}, "IPV4Addr"},
+		{Config{IPV6Addr: "2001:db8::12/64,2001:db8::13/64"}, "IPV6Addr"},
+		{Config{IPV4Addr: "10.0.2.12", IPV4Mode: ModeInherit}, "IPV4Addr"},
+		{Config{IPV4Addr: "10.0.2.12", IPV4Mode: "shared"}, "IPV4Mode"},
+		{Config{IPV6Addr: "10.0.2.12"}, "IPV6Addr"},
+		{Config{Interface: "em 0", IPV4Addr: "10.0.2.12"}, "Interface"},
+	}
+
+	for _, test := range tests {
+		err := validateNetwork(test.form)
+		field := ""
+		if fieldErr, ok := err.(*FieldError); ok {
+			field = fieldErr.Field
+		} else if err != nil {
+			t.Errorf("validateNetwork(%+v) = %#v, want a *FieldError", test.form, err)
+			continue
+		}
+
+		if field != test.field {
+			t.Errorf("validateNetwork(%+v) = %v, want an error about %q", test.form, err, test.field)
+		}
+	}
+}
+
+func TestValidateChecksOtherJailsAddresses(t *testing.T) {
+	h, cleanup := testHost(t, &command.RecordingRunner{})
+	defer cleanup()
+
+	other := Config{JailName: "pie", Hostname: "pie.local", IPV4Addr: "em0|10.0.2.12/24", IPV6Addr: "2001:db8::12/64", Template: "default", UseDefaults: true}
+	err := Create(h, "3254ec98-e683-429a-9849-7e432c24c01b", other, "bootstrap")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ipv4, ipv6 string
+		field      string // The field of the FieldError naming pie, or empty if it's allowed
+	}{
+		{"10.0.2.12", "", "IPV4Addr"},
+		{"10.0.2.14,10.0.2.12", "", "IPV4Addr"},
+		{"10.0.2.200/24", "", "IPV4Addr"},
+		{"", "2001:db8::12", "IPV6Addr"},
+		{"", "2001:db8::200/64", "IPV6Addr"},
+		// Single addresses inside pie's prefixes are allowed.
+		{"10.0.2.13", "", ""},
+		{"", "2001:db8::13", ""},
+		{"10.0.3.12/24", "2001:db8:1::12/64", ""},
+	}
+
+	for _, test := range tests {
+		form := Config{JailName: "mash", Hostname: "mash.local", IPV4Addr: test.ipv4, IPV6Addr: test.ipv6, Template: "default"}
+		err := Validate(h, form)
+
+		fieldErr, ok := err.(*FieldError)
+		switch {
+		case test.field == "" && err != nil:
+			t.Errorf("Validate(%q, %q) = %s, want it allowed", test.ipv4, test.ipv6, err)
+		case test.field != "" && (ok == false || fieldErr.Field != test.field || fieldErr.Jail != "pie"):
+			t.Errorf("Validate(%q, %q) = %#v, want a %s error naming pie", test.ipv4, test.ipv6, err, test.field)
+		}
+	}
+}
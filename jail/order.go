@@ -0,0 +1,181 @@
+package jail
+
+import (
+	"github.com/altsrc-io/Jest/host"
+	"strings"
+)
+
+// The jails in Depends form a cycle, so none of them can be started first.
+type CycleError struct {
+	Jails []string // The cycle, starting and ending with the same jail
+}
+
+func (e *CycleError) Error() string {
+	return "The jails depend on each other in a cycle: " + strings.Join(e.Jails, " -> ") + "."
+}
+
+/*
+	Sort the jails into the order to start them in: every jail after the jails it Depends
+	on, and otherwise by BootPriority and then by name. Dependencies which aren't in jails
+	are left out of the ordering.
+*/
+func StartOrder(jails []Config) ([]Config, error) {
+	byName := make(map[string]Config)
+	for j := range jails {
+		byName[jails[j].JailName] = jails[j]
+	}
+
+	// The number of each jail's dependencies which haven't been ordered yet.
+	waiting := make(map[string]int)
+	for j := range jails {
+		for d, dep := range jails[j].Depends {
+			if _, ok := byName[dep]; ok && contains(jails[j].Depends[:d], dep) == false {
+				waiting[jails[j].JailName]++
+			}
+		}
+	}
+
+	var ordered []Config
+	for len(byName) > 0 {
+		next := ""
+		for name := range byName {
+			if waiting[name] != 0 {
+				continue
+			}
+			if next == "" || startsBefore(byName[name], byName[next]) {
+				next = name
+			}
+		}
+
+		if next == "" {
+			return ordered, findCycle(byName, waiting)
+		}
+
+		ordered = append(ordered, byName[next])
+		delete(byName, next)
+		for name := range byName {
+			if contains(byName[name].Depends, next) {
+				waiting[name]--
+			}
+		}
+	}
+
+	return ordered, nil
+}
+
+func startsBefore(a Config, b Config) bool {
+	if a.BootPriority != b.BootPriority {
+		return a.BootPriority < b.BootPriority
+	}
+	return a.JailName < b.JailName
+}
+
+/*
+	Every jail left to order is waiting on another one which is left, so following the
+	dependencies from any of them, in name order so the error is always the same, leads
+	round a cycle.
+*/
+func findCycle(left map[string]Config, waiting map[string]int) error {
+	first := ""
+	for name := range left {
+		if first == "" || name < first {
+			first = name
+		}
+	}
+
+	var path []string
+	seen := make(map[string]int)
+	for name := first; ; {
+		if at, ok := seen[name]; ok {
+			return &CycleError{append(path[at:], name)}
+		}
+		seen[name] = len(path)
+		path = append(path, name)
+
+		next := ""
+		for _, dep := range left[name].Depends {
+			if _, ok := left[dep]; ok && (next == "" || dep < next) {
+				next = dep
+			}
+		}
+		name = next
+	}
+}
+
+// The named jails and every jail they depend on, directly or not.
+func WithDependencies(jails []Config, names []string) []Config {
+	edges := make(map[string][]string)
+	for j := range jails {
+		edges[jails[j].JailName] = jails[j].Depends
+	}
+	return closure(jails, names, edges)
+}
+
+// The named jails and every jail which depends on them, directly or not.
+func WithDependents(jails []Config, names []string) []Config {
+	edges := make(map[string][]string)
+	for j := range jails {
+		for _, dep := range jails[j].Depends {
+			edges[dep] = append(edges[dep], jails[j].JailName)
+		}
+	}
+	return closure(jails, names, edges)
+}
+
+// The jails reached from the named ones by following the edges, in the order of jails.
+func closure(jails []Config, names []string, edges map[string][]string) []Config {
+	reached := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if reached[name] {
+			return
+		}
+		reached[name] = true
+		for _, next := range edges[name] {
+			visit(next)
+		}
+	}
+	for _, name := range names {
+		visit(name)
+	}
+
+	var selected []Config
+	for j := range jails {
+		if reached[jails[j].JailName] {
+			selected = append(selected, jails[j])
+		}
+	}
+	return selected
+}
+
+// Check the jails the config depends on exist, and don't depend on it in turn.
+func validateDepends(h *host.Host, reqForm Config) error {
+	jails := Configs(h)
+	names := make(map[string]bool)
+	for j := range jails {
+		names[jails[j].JailName] = true
+	}
+
+	for _, dep := range reqForm.Depends {
+		switch {
+		case dep == reqForm.JailName:
+			return &FieldError{"Depends", dep, "", "A jail can't depend on itself."}
+		case names[dep] == false:
+			return &FieldError{"Depends", dep, "", "The jail " + dep + " doesn't exist."}
+		}
+	}
+
+	// Check the order with the config in place of the stored one.
+	withForm := []Config{reqForm}
+	for j := range jails {
+		if jails[j].JailName != reqForm.JailName {
+			withForm = append(withForm, jails[j])
+		}
+	}
+
+	_, err := StartOrder(withForm)
+	if cycle, ok := err.(*CycleError); ok {
+		return &FieldError{"Depends", strings.Join(reqForm.Depends, ","), "", cycle.Error()}
+	}
+	return err
+}
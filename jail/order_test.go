@@ -0,0 +1,173 @@
+package jail
+
+import (
+	"fmt"
+	"github.com/altsrc-io/Jest/command"
+	"github.com/altsrc-io/Jest/host"
+	"reflect"
+	"testing"
+)
+
+// Create each jail from the default template, with the host's defaults.
+func createJails(t *testing.T, h *host.Host, forms ...Config) {
+	for f := range forms {
+		form := forms[f]
+		form.Hostname = form.JailName + ".local"
+		form.IPV4Addr = fmt.Sprintf("10.0.2.%d", 12+f)
+		form.Template, form.UseDefaults = "default", true
+
+		err := Create(h, fmt.Sprintf("3254ec98-e683-429a-9849-7e432c24c0%02d", f), form, "bootstrap")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func names(jails []Config) []string {
+	var found []string
+	for j := range jails {
+		found = append(found, jails[j].JailName)
+	}
+	return found
+}
+
+// The names of the jails the commands created (jail -c) or removed (jail -r), in order.
+func jailsActedOn(commands []command.RecordedCommand, flag string) []string {
+	var acted []string
+	for c := range commands {
+		args := commands[c].Args
+		if commands[c].Name == "jail" && len(args) == 4 && args[2] == flag {
+			acted = append(acted, args[3])
+		}
+	}
+	return acted
+}
+
+func TestStartOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		jails []Config
+		want  []string
+	}{
+		{
+			"by name",
+			[]Config{{JailName: "pie"}, {JailName: "mash"}, {JailName: "gravy"}},
+			[]string{"gravy", "mash", "pie"},
+		},
+		{
+			"by priority then name",
+			[]Config{{JailName: "pie", BootPriority: 1}, {JailName: "mash", BootPriority: 2}, {JailName: "gravy", BootPriority: 2}},
+			[]string{"pie", "gravy", "mash"},
+		},
+		{
+			"after their dependencies, whatever their priority",
+			[]Config{{JailName: "app", Depends: []string{"db", "cache"}}, {JailName: "db", BootPriority: 10}, {JailName: "cache", BootPriority: 5}, {JailName: "proxy", Depends: []string{"app"}}},
+			[]string{"cache", "db", "app", "proxy"},
+		},
+		{
+			"a dependency listed twice",
+			[]Config{{JailName: "app", Depends: []string{"db", "db"}}, {JailName: "db"}},
+			[]string{"db", "app"},
+		},
+		{
+			"dependencies which aren't there are left out",
+			[]Config{{JailName: "app", Depends: []string{"db"}}, {JailName: "cache"}},
+			[]string{"app", "cache"},
+		},
+	}
+
+	for _, test := range tests {
+		order, err := StartOrder(test.jails)
+		if err != nil {
+			t.Errorf("StartOrder %s = %s", test.name, err)
+			continue
+		}
+		if got := names(order); reflect.DeepEqual(got, test.want) == false {
+			t.Errorf("StartOrder %s = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestStartOrderCycles(t *testing.T) {
+	tests := []struct {
+		jails []Config
+		cycle []string
+	}{
+		{
+			[]Config{{JailName: "a", Depends: []string{"b"}}, {JailName: "b", Depends: []string{"a"}}},
+			[]string{"a", "b", "a"},
+		},
+		{
+			[]Config{{JailName: "web"}, {JailName: "c", Depends: []string{"a"}}, {JailName: "b", Depends: []string{"c"}}, {JailName: "a", Depends: []string{"b"}}, {JailName: "d", Depends: []string{"a"}}},
+			[]string{"a", "b", "c", "a"},
+		},
+		{
+			[]Config{{JailName: "a", Depends: []string{"a"}}},
+			[]string{"a", "a"},
+		},
+	}
+
+	for _, test := range tests {
+		_, err := StartOrder(test.jails)
+		cycle, ok := err.(*CycleError)
+		if ok == false {
+			t.Errorf("StartOrder(%+v) = %v, want a *CycleError", test.jails, err)
+			continue
+		}
+		if reflect.DeepEqual(cycle.Jails, test.cycle) == false {
+			t.Errorf("StartOrder(%+v) cycle = %v, want %v", test.jails, cycle.Jails, test.cycle)
+		}
+	}
+}
+
+func TestValidateDepends(t *testing.T) {
+	h, cleanup := testHost(t, &command.RecordingRunner{})
+	defer cleanup()
+	createJails(t, h, Config{JailName: "db"}, Config{JailName: "app", Depends: []string{"db"}})
+
+	tests := []struct {
+		form  Config
+		valid bool
+	}{
+		{Config{JailName: "proxy", Depends: []string{"app", "db"}}, true},
+		{Config{JailName: "db"}, true},
+		{Config{JailName: "proxy", Depends: []string{"cache"}}, false}, // Doesn't exist
+		{Config{JailName: "proxy", Depends: []string{"proxy"}}, false}, // Itself
+		{Config{JailName: "db", Depends: []string{"app"}}, false},      // app depends on db
+	}
+
+	for _, test := range tests {
+		err := validateDepends(h, test.form)
+		if fieldErr, ok := err.(*FieldError); err != nil && (ok == false || fieldErr.Field != "Depends") {
+			t.Errorf("validateDepends(%+v) = %#v, want a Depends *FieldError", test.form, err)
+		}
+		if (err == nil) != test.valid {
+			t.Errorf("validateDepends(%+v) = %v, want valid %t", test.form, err, test.valid)
+		}
+	}
+}
+
+func TestBootStartsInOrder(t *testing.T) {
+	runner := &command.RecordingRunner{}
+	h, cleanup := testHost(t, runner)
+	defer cleanup()
+
+	createJails(t, h,
+		Config{JailName: "proxy", StartAtBoot: true, Depends: []string{"app"}},
+		Config{JailName: "app", Depends: []string{"db"}},
+		Config{JailName: "db"},
+		Config{JailName: "batch", StartAtBoot: true, BootPriority: 10},
+		Config{JailName: "scratch"},
+	)
+
+	err := Boot(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The jails proxy depends on start first, though they aren't flagged, and scratch doesn't start.
+	want := []string{"db", "app", "proxy", "batch"}
+	if got := jailsActedOn(runner.Commands, "-c"); reflect.DeepEqual(got, want) == false {
+		t.Errorf("Boot started %v, want %v", got, want)
+	}
+}
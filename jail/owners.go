@@ -0,0 +1,48 @@
+package jail
+
+import (
+	"github.com/altsrc-io/Jest/host"
+	"github.com/altsrc-io/Jest/store"
+	"github.com/boltdb/bolt"
+)
+
+// The owner of the jail, or "" if it has none, e.g. it was created before jails had owners.
+func Owner(h *host.Host, name string) string {
+	var owner string
+
+	h.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.OwnersBucket)
+		if b == nil {
+			return nil
+		}
+		owner = string(b.Get([]byte(name)))
+		return nil
+	})
+
+	return owner
+}
+
+func SetOwner(h *host.Host, name string, owner string) error {
+	return h.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.OwnersBucket)
+		return b.Put([]byte(name), []byte(owner))
+	})
+}
+
+// Every jail's owner, keyed by the jail name.
+func Owners(h *host.Host) map[string]string {
+	owners := make(map[string]string)
+
+	h.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.OwnersBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			owners[string(k)] = string(v)
+			return nil
+		})
+	})
+
+	return owners
+}
@@ -0,0 +1,249 @@
+package jail
+
+import (
+	"github.com/altsrc-io/Jest/host"
+	"github.com/altsrc-io/Jest/model"
+	"strings"
+)
+
+// A change to a jail's config, applied with Apply.
+type Update = model.JailConfigUpdate
+
+/*
+	The parameters jail -m can change on a running jail, by the name of the Config
+	field. Everything else only takes effect the next time the jail is started.
+*/
+var liveParams = map[string]string{
+	"AllowRawSockets":  "allow.raw_sockets",
+	"AllowMount":       "allow.mount",
+	"AllowSetHostname": "allow.set_hostname",
+	"AllowSysVIPC":     "allow.sysvipc",
+	"Hostname":         "host.hostname",
+	"IPV4Addr":         "ip4.addr",
+	"IPV6Addr":         "ip6.addr",
+}
+
+type updateField struct {
+	name  string
+	value *string // Set by the update
+	field *string // In the config
+}
+
+// Pair each field of the update with the field of the config it changes.
+func updateFields(u Update, jail *Config) []updateField {
+	return []updateField{
+		{"AllowRawSockets", u.AllowRawSockets, &jail.AllowRawSockets},
+		{"AllowMount", u.AllowMount, &jail.AllowMount},
+		{"AllowSetHostname", u.AllowSetHostname, &jail.AllowSetHostname},
+		{"AllowSysVIPC", u.AllowSysVIPC, &jail.AllowSysVIPC},
+		{"Clean", u.Clean, &jail.Clean},
+		{"ConsoleLog", u.ConsoleLog, &jail.ConsoleLog},
+		{"Hostname", u.Hostname, &jail.Hostname},
+		{"Interface", u.Interface, &jail.Interface},
+		{"IPV4Addr", u.IPV4Addr, &jail.IPV4Addr},
+		{"IPV4Mode", u.IPV4Mode, &jail.IPV4Mode},
+		{"IPV6Addr", u.IPV6Addr, &jail.IPV6Addr},
+		{"IPV6Mode", u.IPV6Mode, &jail.IPV6Mode},
+		{"JailUser", u.JailUser, &jail.JailUser},
+		{"SystemUser", u.SystemUser, &jail.SystemUser},
+		{"Start", u.Start, &jail.Start},
+		{"Stop", u.Stop, &jail.Stop},
+		{"StopTimeout", u.StopTimeout, &jail.StopTimeout},
+	}
+}
+
+/*
+	The config with the update applied. If replace is set every field which can be
+	updated is replaced, so the ones the update doesn't set are cleared.
+*/
+func Apply(u Update, jail Config, replace bool) Config {
+	updated := jail
+	fields := updateFields(u, &updated)
+
+	for f := range fields {
+		switch {
+		case fields[f].value != nil:
+			*fields[f].field = *fields[f].value
+		case replace:
+			*fields[f].field = ""
+		}
+	}
+
+	switch {
+	case u.StartAtBoot != nil:
+		updated.StartAtBoot = *u.StartAtBoot
+	case replace:
+		updated.StartAtBoot = false
+	}
+	switch {
+	case u.BootPriority != nil:
+		updated.BootPriority = *u.BootPriority
+	case replace:
+		updated.BootPriority = 0
+	}
+	switch {
+	case u.Depends != nil:
+		updated.Depends = *u.Depends
+	case replace:
+		updated.Depends = nil
+	}
+	switch {
+	case u.Groups != nil:
+		updated.Groups = *u.Groups
+	case replace:
+		updated.Groups = nil
+	}
+
+	return updated
+}
+
+// The names of the fields an update can change which are different in the updated config.
+func Changed(jail Config, updated Config) []string {
+	var changed []string
+	before := updateFields(Update{}, &jail)
+	after := updateFields(Update{}, &updated)
+
+	for f := range before {
+		if *before[f].field != *after[f].field {
+			changed = append(changed, before[f].name)
+		}
+	}
+
+	if jail.StartAtBoot != updated.StartAtBoot {
+		changed = append(changed, "StartAtBoot")
+	}
+	if jail.BootPriority != updated.BootPriority {
+		changed = append(changed, "BootPriority")
+	}
+	if strings.Join(jail.Depends, ",") != strings.Join(updated.Depends, ",") {
+		changed = append(changed, "Depends")
+	}
+	if strings.Join(jail.Groups, ",") != strings.Join(updated.Groups, ",") {
+		changed = append(changed, "Groups")
+	}
+	return changed
+}
+
+// The fields which are only used to decide when the jail is started or stopped.
+var startStopFields = []string{"Stop", "StopTimeout", "StartAtBoot", "BootPriority", "Depends", "Groups"}
+
+/*
+	Whether the running jail has to be restarted for the changed fields to take effect,
+	once the applied ones have been changed with jail -m. A new exec.stop and stop
+	timeout are used the next time the jail is stopped, and the boot settings the next
+	time the host starts, so they don't need one.
+*/
+func RestartRequired(changed []string, applied []string) bool {
+	for c := range changed {
+		if contains(startStopFields, changed[c]) {
+			continue
+		}
+		if contains(applied, changed[c]) == false {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Whether the jail's addresses are added to an interface. jail only adds and removes
+	the aliases when the jail is created and removed, so they're left for the restart.
+*/
+func usesInterface(jail Config) bool {
+	if jail.Interface != "" {
+		return true
+	}
+	for _, f := range networkFields(jail) {
+		addrs, _ := ParseAddrs(f.addrs, f.v6)
+		for a := range addrs {
+			if addrs[a].Interface != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+	Change what can be changed on the running jail with jail -m, returning the fields
+	which were applied. A parameter which has been cleared is left for the restart, as
+	are addresses added to an interface.
+*/
+func ApplyLive(h *host.Host, jail Config, changed []string) ([]string, error) {
+	var applied []string
+	args := []string{"-m", "name=" + jail.JailName}
+
+	fields := updateFields(Update{}, &jail)
+	for f := range fields {
+		param, ok := liveParams[fields[f].name]
+		value := *fields[f].field
+		if ok == false || value == "" || contains(changed, fields[f].name) == false {
+			continue
+		}
+
+		if param == "ip4.addr" || param == "ip6.addr" {
+			if usesInterface(jail) {
+				continue
+			}
+			addrs, err := ParseAddrs(value, param == "ip6.addr")
+			if err != nil {
+				return nil, err
+			}
+			value = FormatAddrs(addrs)
+		}
+
+		if param == "allow.mount" {
+			value = "false"
+			if isTrue(jail.AllowMount) {
+				value = "true"
+			}
+		}
+
+		args = append(args, param+"="+value)
+		applied = append(applied, fields[f].name)
+	}
+
+	if len(applied) == 0 {
+		return nil, nil
+	}
+
+	_, err := h.RunCommand(nil, "jail", args...)
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+func contains(list []string, s string) bool {
+	for l := range list {
+		if list[l] == s {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Check the addresses of an updated config are valid, its hostname and addresses aren't
+	used by another jail, its stop timeout is a number of seconds, the jails it depends on
+	exist and its groups have valid names.
+*/
+func ValidateUpdate(h *host.Host, reqForm Config) error {
+	if reqForm.Hostname == "" {
+		return &FieldError{"Hostname", "", "", "The jail must have a hostname."}
+	}
+	if err := validateNetwork(reqForm); err != nil {
+		return err
+	}
+	if err := ValidateStopTimeout(reqForm.StopTimeout); err != nil {
+		return &FieldError{"StopTimeout", reqForm.StopTimeout, "", err.Error()}
+	}
+	if err := validateDepends(h, reqForm); err != nil {
+		return err
+	}
+	if err := validateGroups(reqForm); err != nil {
+		return err
+	}
+
+	return validateUnique(h, reqForm, reqForm.JailName)
+}
@@ -0,0 +1,406 @@
+/*
+	Package job runs the long operations, such as initialising the host or creating a
+	template, in the background while their progress is polled.
+*/
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/model"
+	"github.com/altsrc-io/Jest/store"
+	"github.com/boltdb/bolt"
+	"github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+	A long running operation, such as initialising the host or creating a template.
+	It's sent as the model.Job it embeds, and the methods are safe to call while it's
+	being polled.
+*/
+type Job struct {
+	model.Job
+
+	mu        sync.Mutex
+	ctx       context.Context
+	cancel    context.CancelFunc
+	lastSave  time.Time
+	manager   *Manager    // The manager whose DB the job is saved in
+	startedBy string      // The ID of the token which started the job
+	secret    interface{} // The Result with its secrets, until it's revealed
+}
+
+const (
+	StatusRunning   = model.JobRunning
+	StatusSucceeded = model.JobSucceeded
+	StatusFailed    = model.JobFailed
+	StatusCancelled = model.JobCancelled
+)
+
+const (
+	TypeInit     = model.JobInit
+	TypeTemplate = model.JobTemplate
+)
+
+/*
+	Jobs are kept in memory while Jest is running, and saved to the jobs bucket whenever
+	the DB is available. An init job can only be saved once it has created the DB.
+*/
+type Manager struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+	db   func() *bolt.DB // The DB to save the jobs in, nil until the host is initialised
+}
+
+func NewManager(db func() *bolt.DB) *Manager {
+	return &Manager{jobs: make(map[string]*Job), db: db}
+}
+
+// A new job, started by the token with the ID.
+func (m *Manager) New(jobType string, startedBy string) *Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		Job: model.Job{
+			ID:      uuid.NewV4().String(),
+			Type:    jobType,
+			Status:  StatusRunning,
+			Created: time.Now(),
+			Updated: time.Now(),
+		},
+		ctx:       ctx,
+		cancel:    cancel,
+		manager:   m,
+		startedBy: startedBy,
+	}
+
+	m.mu.Lock()
+	m.jobs[job.ID] = job
+	m.mu.Unlock()
+
+	job.save()
+	return job
+}
+
+/*
+	The context the job's work should run under, it's cancelled when the job is.
+	The methods on Job are safe to call on a nil job, so the functions which take one
+	can also be used outside of a job.
+*/
+func (j *Job) Context() context.Context {
+	if j == nil {
+		return context.Background()
+	}
+	return j.ctx
+}
+
+// Returns an error if the job has been cancelled, call it between steps.
+func (j *Job) Cancelled() error {
+	if err := j.Context().Err(); err != nil {
+		return fmt.Errorf("The job was cancelled.")
+	}
+	return nil
+}
+
+func (j *Job) SetStep(step string) {
+	log.WithFields(log.Fields{"job": j.id()}).Info(step)
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	j.Step = step
+	j.Log = append(j.Log, time.Now().Format(time.RFC3339)+" "+step)
+	j.Updated = time.Now()
+	j.mu.Unlock()
+
+	j.save()
+}
+
+func (j *Job) Logf(format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	log.WithFields(log.Fields{"job": j.id()}).Debug(line)
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	j.Log = append(j.Log, time.Now().Format(time.RFC3339)+" "+line)
+	j.Updated = time.Now()
+	j.mu.Unlock()
+
+	j.save()
+}
+
+func (j *Job) AddBytes(n int64) {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	j.BytesDownloaded += n
+	j.Updated = time.Now()
+	// Downloads write in small chunks, don't hit the DB for every one of them.
+	throttled := time.Since(j.lastSave) < time.Second
+	j.mu.Unlock()
+
+	if throttled == false {
+		j.save()
+	}
+}
+
+func (j *Job) Succeed(result interface{}) {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	j.Status = StatusSucceeded
+	j.Result = result
+	j.Updated = time.Now()
+	j.mu.Unlock()
+
+	j.save()
+	j.cancel()
+}
+
+/*
+	Succeed with a result which has secrets in it, like the root password of a template.
+	The job is saved and listed with the result, which should leave them out, and secret,
+	the result with them, is only returned once by Reveal.
+*/
+func (j *Job) SucceedWithSecret(result interface{}, secret interface{}) {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	j.secret = secret
+	j.mu.Unlock()
+
+	j.Succeed(result)
+}
+
+/*
+	The job with its secret result, the first time the token which started the job asks
+	for it, otherwise the job as it is. The secret is never saved, so it's lost if Jest
+	is restarted before it's read.
+*/
+func (j *Job) Reveal(tokenID string) *Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.secret == nil || j.Status != StatusSucceeded || tokenID != j.startedBy {
+		return j
+	}
+
+	revealed := &Job{Job: j.Job}
+	revealed.Result = j.secret
+	j.secret = nil
+	return revealed
+}
+
+func (j *Job) Fail(message string, err error) {
+	log.WithFields(log.Fields{"job": j.id(), "error": err}).Warn(message)
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	if j.ctx.Err() != nil {
+		j.Status = StatusCancelled
+	} else {
+		j.Status = StatusFailed
+	}
+	j.Error = message + " " + err.Error()
+	j.Log = append(j.Log, time.Now().Format(time.RFC3339)+" "+j.Error)
+	j.Updated = time.Now()
+	j.mu.Unlock()
+
+	j.save()
+	j.cancel()
+}
+
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+func (j *Job) id() string {
+	if j == nil {
+		return ""
+	}
+	return j.ID
+}
+
+func (j *Job) Running() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.Status == StatusRunning
+}
+
+// Encode the job while holding its lock, so it isn't changed half way through.
+func (j *Job) MarshalJSON() ([]byte, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return json.Marshal(j.Job)
+}
+
+func (j *Job) save() {
+	db := j.manager.db()
+	if db == nil {
+		return
+	}
+
+	j.mu.Lock()
+	j.lastSave = time.Now()
+	j.mu.Unlock()
+
+	encoded, err := json.Marshal(j)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "job": j.ID}).Warn("Failed to encode the struct to JSON before writing to the JestDB.")
+		return
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.JobsBucket)
+		if b == nil {
+			return fmt.Errorf("The jobs bucket doesn't exist yet.")
+		}
+		return b.Put([]byte(j.ID), encoded)
+	})
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "job": j.ID}).Debug("Couldn't save the job to the JestDB.")
+	}
+}
+
+// ToDo: Add error handling here
+func (m *Manager) saved() map[string]*Job {
+	saved := make(map[string]*Job)
+
+	db := m.db()
+	if db == nil {
+		return saved
+	}
+
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.JobsBucket)
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			job := &Job{manager: m}
+			err := json.NewDecoder(bytes.NewReader(v)).Decode(job)
+			if err != nil {
+				log.Warn("Couldn't decode a key:", err)
+				continue
+			}
+
+			saved[job.ID] = job
+		}
+		return nil
+	})
+
+	return saved
+}
+
+// Every job, running or saved, newest first.
+func (m *Manager) List() []*Job {
+	all := m.saved()
+
+	m.mu.Lock()
+	for id := range m.jobs {
+		all[id] = m.jobs[id]
+	}
+	m.mu.Unlock()
+
+	list := []*Job{}
+	for id := range all {
+		list = append(list, all[id])
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created.After(list[j].Created)
+	})
+
+	return list
+}
+
+func (m *Manager) Get(id string) (*Job, error) {
+	job, ok := m.Active(id)
+	if ok {
+		return job, nil
+	}
+
+	if job, ok := m.saved()[id]; ok {
+		return job, nil
+	}
+
+	return nil, fmt.Errorf("There is no job with the ID " + id + ".")
+}
+
+// A job started since Jest was, which are the only ones that can still be running.
+func (m *Manager) Active(id string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+// Return the first running job of the type, used to stop two of them running at once.
+func (m *Manager) Running(jobType string) *Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id := range m.jobs {
+		if m.jobs[id].Type == jobType && m.jobs[id].Running() {
+			return m.jobs[id]
+		}
+	}
+	return nil
+}
+
+/*
+	Jobs which were still running when Jest was stopped will never finish,
+	mark them as failed so clients polling them don't wait forever.
+*/
+func (m *Manager) Recover() {
+	saved := m.saved()
+
+	for id := range saved {
+		if saved[id].Status != StatusRunning {
+			continue
+		}
+
+		saved[id].Status = StatusFailed
+		saved[id].Error = "Jest was restarted before the job finished."
+		saved[id].Updated = time.Now()
+		saved[id].save()
+		log.WithFields(log.Fields{"job": id}).Warn(saved[id].Error)
+	}
+}
+
+// An io.Writer which counts the bytes written to a job, and stops once the job is cancelled.
+type ProgressWriter struct {
+	Job *Job
+	W   io.Writer
+}
+
+func (p ProgressWriter) Write(b []byte) (int, error) {
+	if err := p.Job.Cancelled(); err != nil {
+		return 0, err
+	}
+
+	n, err := p.W.Write(b)
+	p.Job.AddBytes(int64(n))
+	return n, err
+}
@@ -0,0 +1,51 @@
+package job
+
+import (
+	"encoding/json"
+	"github.com/boltdb/bolt"
+	"strings"
+	"testing"
+)
+
+type result struct {
+	Message  string
+	Password string
+}
+
+func TestRevealOnlyOnce(t *testing.T) {
+	m := NewManager(func() *bolt.DB { return nil })
+	j := m.New(TypeTemplate, "admin-token")
+	j.SucceedWithSecret(result{"Created.", ""}, result{"Created.", "hunter2"})
+
+	encoded, _ := json.Marshal(m.List())
+	if strings.Contains(string(encoded), "hunter2") {
+		t.Errorf("The listed jobs have the secret in them: %s", encoded)
+	}
+
+	if got := j.Reveal("other-token").Result; got.(result).Password != "" {
+		t.Errorf("Reveal to another token = %+v, want the result without the secret", got)
+	}
+
+	got := j.Reveal("admin-token")
+	if got.Result.(result).Password != "hunter2" || got.Status != StatusSucceeded {
+		t.Errorf("Reveal to the token which started the job = %+v, want the secret", got.Job)
+	}
+
+	if got := j.Reveal("admin-token").Result; got.(result).Password != "" {
+		t.Errorf("Reveal a second time = %+v, want the result without the secret", got)
+	}
+
+	encoded, _ = json.Marshal(j)
+	if strings.Contains(string(encoded), "hunter2") {
+		t.Errorf("The job has the secret in it after it was revealed: %s", encoded)
+	}
+}
+
+func TestRevealBeforeSucceeding(t *testing.T) {
+	m := NewManager(func() *bolt.DB { return nil })
+	j := m.New(TypeInit, "admin-token")
+
+	if got := j.Reveal("admin-token"); got != j {
+		t.Errorf("Reveal of a running job = %+v, want the job itself", got.Job)
+	}
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"time"
+)
+
+type Config struct {
+	JestDir         string // The directory path for Jest
+	JestDataset     string // The name of the ZFS dataset for Jest (usually mounted on /usr/jail)
+	Disabled        bool
+	Version         int // Incremented every time the config is updated, old versions are kept but disabled
+	Created         time.Time
+	DefaultTemplate string // Used when a jail is created without a template
+	ListenAddr      string // The address the API listens on, changes take effect after a restart
+	FTPMirror       string // The FreeBSD FTP mirror templates are downloaded from
+	JailDefaults    JailDefaults
+	TLS             TLSConfig // Changes take effect after a restart
+}
+
+// The parameters applied to jails created with UseDefaults.
+type JailDefaults struct {
+	AllowRawSockets  string
+	AllowMount       string
+	AllowSetHostname string
+	AllowSysVIPC     string
+	Clean            string
+	JailUser         string
+	SystemUser       string
+	Start            string
+	Stop             string
+	StopTimeout      string
+}
+
+/*
+	The API is served over HTTPS unless TLS is disabled in the config. Without a
+	certificate in the config Jest uses a self-signed one it generates under JestDir.
+*/
+type TLSConfig struct {
+	Disabled          bool   // Serve plain HTTP
+	CertFile          string // PEM certificate, a self-signed one is generated if this isn't set
+	KeyFile           string
+	ClientCAFile      string // PEM CA bundle, client certificates are verified against it if set
+	RequireClientCert bool   // Refuse clients without a certificate signed by the ClientCAFile
+}
+
+type ConfigUpdate struct {
+	DefaultTemplate string
+	ListenAddr      string
+	FTPMirror       string
+	JailDefaults    JailDefaults
+	TLS             *TLSConfig // Replaces the whole TLS config when set
+}
+
+type ConfigRollback struct {
+	Version int
+}
+
+type ConfigResponse struct {
+	Message string
+	Error   *Error
+	Config  Config
+	History []Config
+}
@@ -0,0 +1,50 @@
+/*
+	Package model has the types the Jest API sends and receives, shared by the api
+	package which serves them and the client which sends them. It only needs the
+	standard library, so the client doesn't pull in JestDB, ZFS or the host. The jail,
+	template, snapshot, config and host packages use these types under their own names,
+	e.g. a jail.Config is a model.JailConfig.
+*/
+package model
+
+/*
+	The Error of every response envelope. Code is one of the codes below, for programs
+	to check, Message is the error itself, for people, and Details says what in the
+	request it's about, e.g. {"Field": "IPV4Addr", "Value": "10.0.2.12"}.
+*/
+type Error struct {
+	Code    string
+	Message string
+	Details map[string]string `json:",omitempty"`
+}
+
+// The error catalogue, the README lists the status each is returned with.
+const (
+	CodeInvalidRequest     = "invalid_request"      // 400: the body isn't valid JSON
+	CodeValidationFailed   = "validation_failed"    // 422: a field is missing or not valid
+	CodeNameInUse          = "name_in_use"          // 409: another jail or template has the name
+	CodeHostnameInUse      = "hostname_in_use"      // 409: another jail has the hostname
+	CodeIPInUse            = "ip_in_use"            // 409: another jail has the IP address, or an overlapping prefix
+	CodeConflict           = "conflict"             // 409: the request conflicts with the current state, e.g. the jail is running
+	CodeAlreadyInitialised = "already_initialised"  // 409
+	CodeNotInitialised     = "host_not_initialised" // 409
+	CodeInitialising       = "host_initialising"    // 503: the init job is still running
+	CodeNotFound           = "not_found"            // 404
+	CodeUnauthenticated    = "unauthenticated"      // 401
+	CodeForbidden          = "forbidden"            // 403
+	CodeInternal           = "internal_error"       // 500: Jest, ZFS or a command on the host failed
+)
+
+// The envelope for responses which have nothing else to return.
+type ErrorResponse struct {
+	Message string
+	Error   *Error
+}
+
+// Successful responses log their nil Error too.
+func (e *Error) Error() string {
+	if e == nil {
+		return ""
+	}
+	return e.Message
+}
@@ -0,0 +1,48 @@
+package model
+
+// ToDo: This should be a list of map[string]string really, so people can set any properties they like
+type ZFSParams struct {
+	Name        string
+	Mountpoint  string
+	Compression bool
+}
+
+// A ZFS dataset as the API returns it, the fields of a zfs.Dataset.
+type Dataset struct {
+	Name          string
+	Origin        string
+	Used          uint64
+	Avail         uint64
+	Mountpoint    string
+	Compression   string
+	Type          string
+	Written       uint64
+	Volsize       uint64
+	Usedbydataset uint64
+	Logicalused   uint64
+	Quota         uint64
+}
+
+type InitCreate struct {
+	ZFSParams     ZFSParams
+	FreeBSDParams FreeBSDParams
+}
+
+type InitResponse struct {
+	Message  string
+	Error    *Error
+	Datasets []Dataset
+	Password string
+}
+
+type InitDelete struct {
+	DryRun bool
+}
+
+type DeleteInitResponse struct {
+	Message  string
+	Error    *Error
+	DryRun   bool
+	Jails    []string // The running jails which were (or would be) stopped
+	Datasets []string // The datasets which were (or would be) destroyed, in order
+}
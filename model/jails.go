@@ -0,0 +1,171 @@
+package model
+
+type Jail struct {
+	Name       string
+	JailConfig JailConfig
+	JailState  JailState
+	Owner      string // The Name of the token which created the jail
+}
+
+type JailConfig struct {
+	AllowRawSockets  string
+	AllowMount       string
+	AllowSetHostname string
+	AllowSysVIPC     string
+	Clean            string
+	ConsoleLog       string
+	Hostname         string
+	Interface        string // The interface addresses without their own are added to
+	IPV4Addr         string // Addresses separated by commas, each optionally interface|address/prefix
+	IPV4Mode         string // new, inherit or disable, or empty to leave it to jail
+	IPV6Addr         string
+	IPV6Mode         string
+	JailUser         string
+	JailName         string
+	Path             string // Always the mountpoint of the jail's dataset, set when the jail is created
+	SystemUser       string
+	Start            string
+	Stop             string
+	StopTimeout      string // Seconds exec.stop and the jail's processes get to stop before it's treated as failed
+	Template         string
+	UseDefaults      bool
+	StartAtBoot      bool     // Started by jest boot when the host starts
+	BootPriority     int      // Jails with a lower priority are started first, once the jails they depend on have been
+	Depends          []string // The jails which have to be started before this one
+	Groups           []string // The groups the jail is in, which can be started and stopped together
+}
+
+type JailState struct {
+	Name      string
+	Running   bool
+	JID       string
+	Path      string
+	Hostname  string
+	IPV4Addrs []string
+	IPV6Addrs []string
+	Dying     bool // The jail has been removed but is still releasing its resources
+	// Processes Processes
+}
+
+/*
+	A change to a jail's config. Fields which are nil are left as they are, unless the
+	whole config is being replaced. The jail's name, template and path can't be changed.
+*/
+type JailConfigUpdate struct {
+	AllowRawSockets  *string
+	AllowMount       *string
+	AllowSetHostname *string
+	AllowSysVIPC     *string
+	Clean            *string
+	ConsoleLog       *string
+	Hostname         *string
+	Interface        *string
+	IPV4Addr         *string
+	IPV4Mode         *string
+	IPV6Addr         *string
+	IPV6Mode         *string
+	JailUser         *string
+	SystemUser       *string
+	Start            *string
+	Stop             *string
+	StopTimeout      *string
+	StartAtBoot      *bool
+	BootPriority     *int
+	Depends          *[]string
+	Groups           *[]string
+}
+
+/*
+	What starting or stopping a jail printed, so a failing rc script can be diagnosed
+	without a shell on the host. exec.start and exec.stop write to the console log when
+	the jail has one, rather than to jail's stdout.
+*/
+type JailOutput struct {
+	Commands   []string // The commands run, in order
+	Stdout     string
+	Stderr     string
+	ConsoleLog string // What was written to the console log while the commands ran
+	Forced     bool   // Stopping the jail failed, so it was removed with jail -R
+}
+
+/*
+	What happened to one jail when starting or stopping several in order. Action is
+	start or stop, or empty if the jail was already started or stopped.
+*/
+type JailStep struct {
+	Name    string
+	Action  string
+	State   JailState
+	Output  JailOutput
+	Error   string
+	Skipped bool // Not started because a jail it depends on failed, or not stopped because a jail which depends on it failed
+}
+
+type CreateJailResponse struct {
+	Message string
+	Error   *Error
+	JUID    string
+}
+
+type JailsResponse struct {
+	Message string
+	Error   *Error
+	Jails   []Jail
+}
+
+type JailResponse struct {
+	Message string
+	Error   *Error
+	Jails   Jail
+}
+
+type JailDelete struct {
+	DestroySnapshots bool // Destroy the snapshots of the jail along with its dataset
+}
+
+type JailUpdate struct {
+	JailConfigUpdate
+	Apply bool // Change what can be changed on the running jail straight away, with jail -m
+}
+
+type JailUpdateResponse struct {
+	Message         string
+	Error           *Error
+	Jail            Jail
+	Changed         []string // The fields which changed
+	Applied         []string // The fields which were changed on the running jail
+	RestartRequired bool     // The jail is running and has to be restarted for the rest to take effect
+}
+
+type JailStateResponse struct {
+	Message   string
+	Error     *Error
+	JailState JailState
+}
+
+type JailAction struct {
+	StopTimeout  int  // Seconds, overrides the jail's StopTimeout for this stop
+	Force        bool // Remove the jail with jail -R if exec.stop fails or times out, true unless it's set to false
+	Dependencies bool // Start the jails it depends on first, or stop the jails which depend on it first
+}
+
+type JailActionResponse struct {
+	Message   string
+	Error     *Error
+	JailState JailState
+	Output    JailOutput
+	Steps     []JailStep // With Dependencies, every jail which was started or stopped, in order
+}
+
+type GroupsResponse struct {
+	Message string
+	Error   *Error
+	Groups  map[string][]string // The names of the jails in each group
+}
+
+type GroupActionResponse struct {
+	Message string
+	Error   *Error
+	Group   string
+	Steps   []JailStep // Every jail which was started or stopped, in order
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+)
+
+/*
+	A long running operation, such as initialising the host or creating a template.
+	The HTTP request which starts a job returns straight away with the job ID, and
+	the job's progress can then be polled from /jobs/{id}.
+*/
+type Job struct {
+	ID              string
+	Type            string
+	Status          string
+	Step            string // What the job is currently doing
+	BytesDownloaded int64
+	Log             []string
+	Error           string
+	Result          interface{} // Set when the job succeeds, e.g. the InitResponse for an init job
+	Created         time.Time
+	Updated         time.Time
+}
+
+const (
+	JobRunning   = "Running"
+	JobSucceeded = "Succeeded"
+	JobFailed    = "Failed"
+	JobCancelled = "Cancelled"
+)
+
+const (
+	JobInit     = "init"
+	JobTemplate = "template"
+)
+
+type JobResponse struct {
+	Message string
+	Error   *Error
+	Job     *Job
+}
+
+type JobsResponse struct {
+	Message string
+	Error   *Error
+	Jobs    []*Job
+}
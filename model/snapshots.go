@@ -0,0 +1,34 @@
+package model
+
+/*
+	Snapshots are named relative to the Jest dataset, the same way the datasets are laid out:
+	"mash@pre-upgrade" is a snapshot of the jail mash and ".default@Ready" is a snapshot of the template default.
+*/
+type Snapshot struct {
+	Name       string
+	Dataset    string // The full ZFS name of the snapshot, e.g. zroot/jails/mash@pre-upgrade
+	Target     string // The name of the jail or template the snapshot belongs to
+	IsTemplate bool
+	Used       uint64
+	JailConfig JailConfig // The config of the jail when the snapshot was taken, restored on rollback
+}
+
+type SnapshotCreate struct {
+	Name string
+}
+
+type SnapshotRollback struct {
+	DestroyMoreRecent bool
+}
+
+type SnapshotsResponse struct {
+	Message   string
+	Error     *Error
+	Snapshots []Snapshot
+}
+
+type SnapshotResponse struct {
+	Message  string
+	Error    *Error
+	Snapshot Snapshot
+}
@@ -0,0 +1,38 @@
+package model
+
+type Template struct {
+	Name      string
+	Disabled  bool
+	Path      string
+	Version   string
+	ZFSParams ZFSParams
+}
+
+type FreeBSDParams struct {
+	Name         string
+	Version      string
+	ApplyUpdates bool
+}
+
+type TemplatesResponse struct {
+	Message   string
+	Error     *Error
+	Templates []Template
+}
+
+type TemplateResponse struct {
+	Message  string
+	Error    *Error
+	Template Template
+}
+
+type CreateTemplateResponse struct {
+	Message  string
+	Error    *Error
+	Template Template
+	Password string
+}
+
+type TemplateUpdate struct {
+	Disabled bool // Disabled templates are kept, but can't be used to create new jails
+}
@@ -0,0 +1,164 @@
+/*
+	Package snapshot takes ZFS snapshots of the jails and templates, and keeps a record of
+	each one in JestDB along with the config the jail had when it was taken.
+*/
+package snapshot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/host"
+	"github.com/altsrc-io/Jest/model"
+	"github.com/altsrc-io/Jest/store"
+	"github.com/boltdb/bolt"
+	"github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+)
+
+// A snapshot of a jail or template, and the name it's given by ParseName.
+type Snapshot = model.Snapshot
+
+func ParseName(name string) (string, string, error) {
+	regex := `^\.?[A-Za-z0-9_\-.:]+@[A-Za-z0-9_\-.:]+$`
+	r, err := regexp.Compile(regex)
+	if err != nil {
+		return "", "", err
+	}
+
+	if r.MatchString(name) == false {
+		return "", "", fmt.Errorf("The snapshot name " + name + " is not valid. It should be in the form <jail>@<snapshot> or .<template>@<snapshot>.")
+	}
+
+	parts := strings.SplitN(name, "@", 2)
+	return parts[0], parts[1], nil
+}
+
+func DatasetName(h *host.Host, target string) string {
+	return h.Conf.JestDataset + "/" + target
+}
+
+// ToDo: Add error handling here
+func Records(h *host.Host) map[string]Snapshot {
+	records := make(map[string]Snapshot)
+
+	h.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.SnapshotsBucket)
+
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			encoded := bytes.NewReader(v)
+			form := Snapshot{}
+			err := json.NewDecoder(encoded).Decode(&form)
+			if err != nil {
+				log.Warn("Couldn't decode a key:", err)
+			}
+
+			records[form.Dataset] = form
+		}
+		return nil
+	})
+
+	return records
+}
+
+func PutRecord(h *host.Host, snapshot Snapshot) error {
+	sUID := uuid.NewV4()
+
+	encoded, err := json.Marshal(snapshot)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "sUID": sUID.String()}).Warn("Failed to encode the struct to JSON before writing to the JestDB.")
+		return err
+	}
+
+	return h.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.SnapshotsBucket)
+		return b.Put(sUID.Bytes(), encoded)
+	})
+}
+
+// Remove the records of any snapshots that no longer exist in ZFS.
+func Prune(h *host.Host) error {
+	datasets, err := h.Storage.Snapshots(h.Conf.JestDataset)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool)
+	for d := range datasets {
+		existing[datasets[d].Name] = true
+	}
+
+	return h.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.SnapshotsBucket)
+		c := b.Cursor()
+
+		// Deleting while iterating makes the cursor skip keys, so collect them first.
+		var stale [][]byte
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			form := Snapshot{}
+			err := json.NewDecoder(bytes.NewReader(v)).Decode(&form)
+			if err != nil {
+				log.Warn("Couldn't decode a key:", err)
+			}
+
+			if existing[form.Dataset] == false {
+				stale = append(stale, k)
+			}
+		}
+
+		for k := range stale {
+			err := b.Delete(stale[k])
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func List(h *host.Host) ([]Snapshot, error) {
+	var snapshots = []Snapshot{}
+
+	datasets, err := h.Storage.Snapshots(h.Conf.JestDataset)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "dataset": h.Conf.JestDataset}).Warning("Error reading ZFS snapshots.")
+		return snapshots, err
+	}
+
+	records := Records(h)
+
+	for d := range datasets {
+		name := strings.TrimPrefix(datasets[d].Name, h.Conf.JestDataset+"/")
+		target, _, err := ParseName(name)
+		if err != nil {
+			// Snapshots of the Jest dataset itself, or of datasets Jest didn't create.
+			continue
+		}
+
+		snapshot := records[datasets[d].Name]
+		snapshot.Name = name
+		snapshot.Dataset = datasets[d].Name
+		snapshot.Target = strings.TrimPrefix(target, ".")
+		snapshot.IsTemplate = strings.HasPrefix(target, ".")
+		snapshot.Used = datasets[d].Used
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, nil
+}
+
+func Find(name string, snapshots []Snapshot) (Snapshot, error) {
+	for s := range snapshots {
+		if snapshots[s].Name == name {
+			return snapshots[s], nil
+		}
+	}
+	return Snapshot{}, fmt.Errorf("There is no snapshot on this host with the name " + name + ".")
+}
+
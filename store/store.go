@@ -0,0 +1,68 @@
+/*
+	Package store keeps Jest's records in JestDB, a bolt DB in the Jest directory.
+	Each kind of record has its own bucket, and the records are JSON keyed by a UUID,
+	apart from the owners which are keyed by the jail name, and what Jest changed on
+	the host, which is keyed by what it is.
+*/
+package store
+
+import (
+	"fmt"
+	"github.com/boltdb/bolt"
+	"path/filepath"
+	"time"
+)
+
+var (
+	JailsBucket     = []byte("jails")
+	TemplatesBucket = []byte("templates")
+	ConfigBucket    = []byte("config")
+	SnapshotsBucket = []byte("snapshots")
+	JobsBucket      = []byte("jobs")
+	TokensBucket    = []byte("tokens")
+	OwnersBucket    = []byte("owners")
+	HostBucket      = []byte("host")
+)
+
+var buckets = [][]byte{JailsBucket, TemplatesBucket, ConfigBucket, SnapshotsBucket, JobsBucket, TokensBucket, OwnersBucket, HostBucket}
+
+const FileName = "JestDB.bolt"
+
+// How long to wait for another process, such as a running Jest, to release JestDB.
+var OpenTimeout = 10 * time.Second
+
+// Open JestDB in the directory, creating it and any missing buckets if needed.
+func Open(dir string) (*bolt.DB, error) {
+	db, err := bolt.Open(filepath.Join(dir, FileName), 0600, &bolt.Options{Timeout: OpenTimeout})
+	if err == bolt.ErrTimeout {
+		return db, fmt.Errorf("JestDB is locked, another Jest is using it: %s", err)
+	}
+	if err != nil {
+		return db, err
+	}
+
+	err = CreateBuckets(db)
+	if err != nil {
+		db.Close()
+		return db, err
+	}
+
+	return db, nil
+}
+
+// Create buckets in the database if they don't exist
+func CreateBuckets(db *bolt.DB) error {
+	for i := range buckets {
+		err := db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(buckets[i])
+			if err != nil {
+				return fmt.Errorf("create bucket: %s", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package template
+
+import (
+	"fmt"
+	"github.com/altsrc-io/Jest/host"
+	"github.com/altsrc-io/Jest/job"
+	"github.com/altsrc-io/Jest/model"
+	"github.com/jlaffaye/ftp"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+type FreeBSDParams = model.FreeBSDParams
+
+// Download the FreeBSD archive files, recording the bytes downloaded against the job.
+func DownloadVersion(h *host.Host, j *job.Job, ver string, path string, files []string) error {
+	site := h.FTPSite()
+	log.WithFields(log.Fields{"site": site}).Debug("Connecting to FreeBSD FTP mirror.")
+	client, err := ftp.Dial(site)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "site": site}).Warning("Couldn't connect to the FreeBSD FTP mirror.")
+		return err
+	}
+
+	log.WithFields(log.Fields{"site": site, "credentials": "anonymous/anonymous"}).Debug("Logging in to FTP mirror.")
+	err = client.Login("anonymous", "anonymous")
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "site": site, "credentials": "anonymous/anonymous"}).Warning("Couldn't login to the FreeBSD FTP mirror.")
+		return err
+	}
+
+	for i := 0; i < len(files); i++ {
+		if err := j.Cancelled(); err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{"file": files[i]}).Debug("Creating file.")
+		file, err := os.Create(filepath.Join(path, files[i]))
+		if err != nil {
+			log.WithFields(log.Fields{"error": err, "file": files[i]}).Warning("Couldn't create file.")
+			return err
+		}
+
+		log.WithFields(log.Fields{"file": site + "/pub/FreeBSD/releases/amd64/" + ver + "/" + files[i]}).Debug("Downloading file.")
+		resp, err := client.Retr("pub/FreeBSD/releases/amd64/" + ver + "/" + files[i])
+		if err != nil {
+			log.WithFields(log.Fields{"error": err, "file": site + "/pub/FreeBSD/releases/amd64/" + ver + "/" + files[i]}).Warning("Couldn't download file.")
+			return err
+		}
+
+		j.Logf("Downloading %s.", files[i])
+		_, err = io.Copy(job.ProgressWriter{Job: j, W: file}, resp)
+
+		file.Close()
+		resp.Close()
+		log.WithFields(log.Fields{"file": files[i]}).Debug("Closed file.")
+		if err != nil {
+			log.WithFields(log.Fields{"error": err, "file": files[i]}).Warning("Couldn't download file.")
+			return err
+		}
+	}
+
+	return nil
+}
+
+func ValidateVersion(v string) error {
+	regex := `^[0-9]*\.[0-9]*-[A-Z0-9]*$`
+	log.WithFields(log.Fields{"version": v, "regex": regex}).Debug("Validating FreeBSD version against the regex.")
+	r, err := regexp.Compile(regex)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "version": v, "regex": regex}).Debug("Failed to compile the regex.")
+		return err
+	}
+
+	if r.MatchString(v) == false {
+		log.WithFields(log.Fields{"version": v, "regex": regex}).Warning("Failed to match the version against the regex.")
+		return fmt.Errorf("The version specified: " + v + " is not valid. The version should match the regex " + regex)
+	}
+
+	return nil
+}
+
+func RemoveOldArchives(path string, files []string) error {
+	for i := 0; i < len(files); i++ {
+		log.WithFields(log.Fields{"file": files[i], "path": path}).Debug("Removing old FreeBSD archive file.")
+		err := os.Remove(filepath.Join(path, files[i]))
+		if err != nil {
+			log.WithFields(log.Fields{"error": err, "file": files[i], "path": path}).Warning("Couldn't remove the old archive file.")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Chroot changes the root of the whole process, so only one base jail can be prepared at a time.
+var chrootLock sync.Mutex
+
+func PrepareBaseJail(h *host.Host, path string, applyUpdates bool) (string, error) {
+	chrootLock.Lock()
+	defer chrootLock.Unlock()
+
+	log.Debug("Copying /etc/resolv.conf into the base jail.")
+	err := host.CopyFile("/etc/resolv.conf", filepath.Join(path, "/etc/resolv.conf"))
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Warning("Failed to copy /etc/resolv.conf into the base jail.")
+		return "", err
+	}
+
+	log.Debug("Creating /dev/null volume in base jail")
+	baseDev := filepath.Join(path, "/dev")
+	baseDevNull := filepath.Join(baseDev, "/null")
+	if _, err := os.Stat(baseDevNull); err == nil {
+		log.WithFields(log.Fields{"volName": baseDevNull}).Debug("Volume already exists - skipping.")
+	} else {
+		log.WithFields(log.Fields{"volName": baseDev}).Debug("Making " + baseDev + " volume.")
+		_, err := h.RunCommand(nil, "mount", "-t", "devfs", "dev", baseDev)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	log.Debug("Chrooting into the base jail.")
+	err = os.Chdir("/")
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Warning("Couldn't cd into /")
+		return "", err
+	}
+	_, err = h.RunCommand(nil, "sysctl", "kern.chroot_allow_open_directories=2")
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Warning("Couldn't set sysctl kern.chroot_allow_open_directories to allow us to escape chroot")
+		return "", err
+	}
+	exitChroot, err := host.Chroot(path)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Warning("Couldn't chroot into the base jail.")
+		return "", err
+	}
+
+	dirs := []string{"/usr/ports", "/usr/home"}
+	for i := 0; i < len(dirs); i++ {
+		log.WithFields(log.Fields{"dirName": dirs[i]}).Debug("Checking directory.")
+		if _, err := os.Stat(dirs[i]); err == nil {
+			log.WithFields(log.Fields{"dirName": dirs[i]}).Debug("Directory already exists - skipping.")
+		} else {
+			err := os.Mkdir(dirs[i], 755)
+			if err != nil {
+				log.WithFields(log.Fields{"error": err}).Warning("Could create the directory " + dirs[i] + ".")
+				return "", err
+			}
+			log.WithFields(log.Fields{"dirName": dirs[i]}).Debug("Created directory.")
+		}
+	}
+
+	log.Debug("Linking /usr/home to /home.")
+	_, err = os.Stat("/home")
+	if err == nil {
+		log.WithFields(log.Fields{"linkName": "/home"}).Debug("Symlink already exists - skipping.")
+	} else {
+		err = os.Symlink("/usr/home", "/home")
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Warning("Couldn't link /usr/home to /home.")
+			return "", err
+		}
+	}
+
+	log.Debug("Changing directory to /etc/mail.")
+	err = os.Chdir("/etc/mail")
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Warning("Couldn't change into /etc/mail directory.")
+		return "", err
+	}
+
+	log.Debug("Building the mail aliases.")
+	_, err = h.RunCommand(nil, "make", "aliases")
+	if err != nil {
+		return "", err
+	}
+
+	rcConfOpts := []string{
+		"#Added by Jest:",
+		`sendmail_enable="NONE"`,
+		`syslogd_flags="-ss"`,
+		`rpcbind_enable="NO"`,
+	}
+	err = host.AppendMissingLinesToFile("/etc/rc.conf", rcConfOpts)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "fileName": "/etc/rc.conf"}).Warning("Couldn't add the options to /etc/rc.conf.")
+		return "", err
+	}
+
+	makeConfOpts := []string{
+		"#Added by Jest:",
+		"WITH_PKGNG=yes",
+		"WRKDIRPREFIX=/var/ports",
+		"DISTDIR=/var/ports/distfiles",
+		"PACKAGES=/var/ports/packages",
+		"INDEXDIR=/usr/ports",
+	}
+	err = host.AppendMissingLinesToFile("/etc/make.conf", makeConfOpts)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "fileName": "/etc/make.conf"}).Warning("Couldn't add the options to /etc/make.conf.")
+		return "", err
+	}
+
+	log.Debug("Setting the root password.")
+	pw := host.RandomString(128)
+	_, err = h.RunCommand(strings.NewReader(pw+"\n"), "pw", "usermod", "root", "-h", "0")
+	if err != nil {
+		return "", err
+	}
+
+	ignoreErrorCmds := [][]string{{"pkg"}}
+	switch {
+	case applyUpdates == true:
+		ignoreErrorCmds = append(ignoreErrorCmds, []string{"freebsd-update", "--not-running-from-cron", "fetch", "install"})
+	}
+	log.Debug("Updating the base jail.")
+	for i := 0; i < len(ignoreErrorCmds); i++ {
+		_, err = h.RunCommand(nil, ignoreErrorCmds[i][0], ignoreErrorCmds[i][1:]...)
+		if err != nil {
+			// Do nothing. We know pkg will spit out some errors, we just want it to create the dirs.
+		}
+	}
+
+	log.Debug("Exiting from the chroot.")
+	err = exitChroot()
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Warning("Couldn't exit from the chroot.")
+		return "", err
+	}
+
+	_, err = h.RunCommand(nil, "sysctl", "kern.chroot_allow_open_directories=1")
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Warning("Couldn't set sysctl kern.chroot_allow_open_directories to restrict croot access")
+		return "", err
+	}
+
+	return pw, nil
+}
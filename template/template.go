@@ -0,0 +1,239 @@
+/*
+	Package template manages the templates jails are cloned from. Each template is a
+	FreeBSD base jail in the dataset <dataset>/.<name>, with a Ready snapshot the jails
+	are cloned from.
+*/
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/altsrc-io/Jest/host"
+	"github.com/altsrc-io/Jest/job"
+	"github.com/altsrc-io/Jest/model"
+	"github.com/altsrc-io/Jest/store"
+	"github.com/altsrc-io/Jest/zfs"
+	"github.com/boltdb/bolt"
+	"github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"path/filepath"
+	"regexp"
+)
+
+type Template = model.Template
+
+func ValidateName(name string) error {
+	regex := `^[A-Za-z0-9_\-]+$`
+	r, err := regexp.Compile(regex)
+	if err != nil {
+		return err
+	}
+
+	if r.MatchString(name) == false {
+		return fmt.Errorf("The template name " + name + " is not valid. The name should match the regex " + regex)
+	}
+
+	// The Jest dataset already lives at <dataset>/.jest
+	if name == "jest" {
+		return fmt.Errorf("The template name jest is reserved.")
+	}
+
+	return nil
+}
+
+// Destroy the template's dataset and its snapshots.
+func DestroyDataset(h *host.Host, name string) error {
+	return h.DestroyZFSDataset(h.Conf.JestDataset+"/."+name, true)
+}
+
+/*
+	Create a new template dataset at <dataset>/.<name> and populate it the same way the
+	template created by /init is: download, extract, prepare and snapshot it as Ready.
+	Returns the root password set in the template.
+*/
+func Create(h *host.Host, job *job.Job, params FreeBSDParams) (Template, string, error) {
+	path := filepath.Join(h.Conf.JestDir, "."+params.Name)
+
+	root, err := h.Storage.GetDataset(h.Conf.JestDataset)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "dataset": h.Conf.JestDataset}).Warning("Couldn't find the Jest dataset.")
+		return Template{}, "", err
+	}
+
+	zfsParams := host.ZFSParams{Name: h.Conf.JestDataset, Mountpoint: h.Conf.JestDir, Compression: root.Compression != "off"}
+	template := Template{Name: params.Name, Path: path, Version: params.Version, ZFSParams: zfsParams}
+
+	job.SetStep("Creating template dataset.")
+	dataset, err := h.CreateZFSDataset(h.Conf.JestDataset+"/."+params.Name, map[string]string{"mountpoint": path})
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "template": params.Name}).Warning("Failed to create dataset")
+		return template, "", err
+	}
+
+	pw, err := populate(h, job, *dataset, params)
+	if err != nil {
+		// Don't leave a half built template behind, so the request can be retried.
+		cErr := DestroyDataset(h, params.Name)
+		if cErr != nil {
+			log.WithFields(log.Fields{"error": cErr, "template": params.Name}).Warning("Failed to clean up the template dataset.")
+		}
+		return template, "", err
+	}
+
+	job.SetStep("Writing template settings to the DB.")
+	err = Put(h, template)
+	if err != nil {
+		return template, "", err
+	}
+
+	return template, pw, nil
+}
+
+// Record a new template in the DB.
+func Put(h *host.Host, template Template) error {
+	tUID := uuid.NewV4()
+
+	encoded, err := json.Marshal(template)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "tUID": tUID.String()}).Warn("Failed to encode the struct to JSON before writing to the JestDB.")
+		return err
+	}
+
+	return h.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.TemplatesBucket)
+		return b.Put(tUID.Bytes(), encoded)
+	})
+}
+
+func populate(h *host.Host, job *job.Job, dataset zfs.Dataset, params FreeBSDParams) (string, error) {
+	files := []string{"base.txz", "lib32.txz", "src.txz"}
+
+	job.SetStep("Downloading FreeBSD files.")
+	err := DownloadVersion(h, job, params.Version, dataset.Mountpoint, files)
+	if err != nil {
+		return "", err
+	}
+
+	if err := job.Cancelled(); err != nil {
+		return "", err
+	}
+
+	job.SetStep("Extracting FreeBSD archive files.")
+	err = host.ExtractFiles(dataset.Mountpoint, files)
+	if err != nil {
+		return "", err
+	}
+
+	job.SetStep("Removing the extracted archive files.")
+	err = RemoveOldArchives(dataset.Mountpoint, files)
+	if err != nil {
+		return "", err
+	}
+
+	if err := job.Cancelled(); err != nil {
+		return "", err
+	}
+
+	job.SetStep("Preparing the base jail.")
+	pw, err := PrepareBaseJail(h, dataset.Mountpoint, params.ApplyUpdates)
+	if err != nil {
+		return "", err
+	}
+
+	job.SetStep("Taking a snapshot of the base jail.")
+	_, err = h.SnapshotZFSDataset(dataset)
+	if err != nil {
+		return "", err
+	}
+
+	return pw, nil
+}
+
+// Disabled templates are kept, but can't be used to create new jails.
+func SetDisabled(h *host.Host, name string, disabled bool) (Template, error) {
+	var template Template
+
+	err := h.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.TemplatesBucket)
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			form := Template{}
+			err := json.NewDecoder(bytes.NewReader(v)).Decode(&form)
+			if err != nil {
+				log.Warn("Couldn't decode a key:", err)
+			}
+
+			if form.Name == name {
+				form.Disabled = disabled
+				encoded, err := json.Marshal(form)
+				if err != nil {
+					return err
+				}
+				template = form
+				return b.Put(k, encoded)
+			}
+		}
+
+		return fmt.Errorf("There is no template on this host with the name " + name + ".")
+	})
+
+	return template, err
+}
+
+// Remove the template from the DB, once its dataset has been destroyed.
+func DeleteRecord(h *host.Host, name string) error {
+	return h.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.TemplatesBucket)
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			form := Template{}
+			err := json.NewDecoder(bytes.NewReader(v)).Decode(&form)
+			if err != nil {
+				log.Warn("Couldn't decode a key:", err)
+			}
+
+			if form.Name == name {
+				return b.Delete(k)
+			}
+		}
+
+		return fmt.Errorf("There is no template on this host with the name " + name + " to delete.")
+	})
+}
+
+func List(h *host.Host) []Template {
+	var templates = []Template{}
+
+	h.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(store.TemplatesBucket)
+
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			encoded := bytes.NewReader(v)
+			form := Template{}
+			err := json.NewDecoder(encoded).Decode(&form)
+			if err != nil {
+				log.Warn("Couldn't decode a key:", err)
+			}
+
+			templates = append(templates, form)
+
+		}
+		return nil
+	})
+
+	return templates
+}
+
+func Find(templateName string, templates []Template) (Template, error) {
+	for t := range templates {
+		if templates[t].Name == templateName {
+			return templates[t], nil
+		}
+	}
+	return Template{}, fmt.Errorf("There is not template on this host with the name " + templateName + ".")
+}
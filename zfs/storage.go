@@ -0,0 +1,448 @@
+package zfs
+
+import (
+	"fmt"
+	"github.com/altsrc-io/Jest/command"
+	gozfs "github.com/mistifyio/go-zfs"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+	Every ZFS operation Jest makes goes through a Storage, so the API can be run
+	against an in-memory set of datasets on hosts without ZFS. Datasets are always
+	referred to by their full name, e.g. zroot/jails/mash or zroot/jails/.default@Ready.
+*/
+type Storage interface {
+	Datasets() ([]*Dataset, error) // Every filesystem, but not the snapshots
+	GetDataset(name string) (*Dataset, error)
+	CreateFilesystem(name string, properties map[string]string) (*Dataset, error)
+	Snapshot(dataset string, name string) (*Dataset, error)
+	Snapshots(dataset string) ([]*Dataset, error) // The snapshots of the dataset and its descendants
+	Clone(snapshot string, destination string, properties map[string]string) (*Dataset, error)
+	Rollback(snapshot string, destroyMoreRecent bool) error
+	Destroy(name string, recursive bool) error
+	GetProperty(name string, property string) (string, error)
+	SetProperty(name string, property string, value string) error
+	InheritProperty(name string, property string) error
+}
+
+// A dataset as go-zfs describes it, so users of the Storage don't have to import go-zfs too.
+type Dataset = gozfs.Dataset
+
+// Runs the operations on the host's pools with go-zfs, and the Runner where go-zfs falls short.
+type GoZFSStorage struct {
+	Runner command.Runner
+}
+
+func (GoZFSStorage) Datasets() ([]*Dataset, error) {
+	return gozfs.Filesystems("")
+}
+
+func (GoZFSStorage) GetDataset(name string) (*Dataset, error) {
+	return gozfs.GetDataset(name)
+}
+
+func (GoZFSStorage) CreateFilesystem(name string, properties map[string]string) (*Dataset, error) {
+	return gozfs.CreateFilesystem(name, properties)
+}
+
+func (GoZFSStorage) Snapshot(dataset string, name string) (*Dataset, error) {
+	d, err := gozfs.GetDataset(dataset)
+	if err != nil {
+		return nil, err
+	}
+	return d.Snapshot(name, false)
+}
+
+func (GoZFSStorage) Snapshots(dataset string) ([]*Dataset, error) {
+	return gozfs.Snapshots(dataset)
+}
+
+func (GoZFSStorage) Clone(snapshot string, destination string, properties map[string]string) (*Dataset, error) {
+	s, err := gozfs.GetDataset(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return s.Clone(destination, properties)
+}
+
+func (GoZFSStorage) Rollback(snapshot string, destroyMoreRecent bool) error {
+	s, err := gozfs.GetDataset(snapshot)
+	if err != nil {
+		return err
+	}
+	return s.Rollback(destroyMoreRecent)
+}
+
+func (GoZFSStorage) Destroy(name string, recursive bool) error {
+	d, err := gozfs.GetDataset(name)
+	if err != nil {
+		return err
+	}
+
+	flags := gozfs.DestroyDefault
+	if recursive {
+		flags = gozfs.DestroyRecursive
+	}
+	return d.Destroy(flags)
+}
+
+// go-zfs doesn't pass -H to zfs get, so it reads the header instead of the value.
+func (g GoZFSStorage) GetProperty(name string, property string) (string, error) {
+	out, err := command.Run(g.Runner, nil, "zfs", "get", "-H", "-o", "value", property, name)
+	return strings.TrimSpace(out), err
+}
+
+func (GoZFSStorage) SetProperty(name string, property string, value string) error {
+	d, err := gozfs.GetDataset(name)
+	if err != nil {
+		return err
+	}
+	return d.SetProperty(property, value)
+}
+
+func (g GoZFSStorage) InheritProperty(name string, property string) error {
+	_, err := command.Run(g.Runner, nil, "zfs", "inherit", property, name)
+	return err
+}
+
+type memoryDataset struct {
+	dataset    Dataset
+	properties map[string]string // Only the properties set on this dataset, not the inherited ones
+	created    int               // Orders the snapshots of a dataset, as the creation time does in ZFS
+}
+
+/*
+	Keeps the datasets in memory, for running the API on hosts without ZFS. It follows
+	the rules ZFS does for the relationships between datasets: parents have to exist,
+	datasets with children or snapshots with clones can't be destroyed, and properties
+	are inherited from the parent. The errors read like the ones zfs(8) returns.
+*/
+type MemoryStorage struct {
+	mu       sync.Mutex
+	datasets map[string]*memoryDataset
+	created  int
+}
+
+// Create a MemoryStorage with the pools, each mounted at /<pool>.
+func NewMemoryStorage(pools ...string) *MemoryStorage {
+	m := &MemoryStorage{datasets: make(map[string]*memoryDataset)}
+	for p := range pools {
+		m.add(pools[p], gozfs.DatasetFilesystem, "", map[string]string{"mountpoint": "/" + pools[p]})
+	}
+	return m
+}
+
+// The dataset a snapshot was taken of, or the parent of a filesystem. Pools have no parent.
+func parentDatasetName(name string) string {
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		return name[:i]
+	}
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+func (m *MemoryStorage) add(name string, datasetType string, origin string, properties map[string]string) {
+	props := make(map[string]string)
+	for k, v := range properties {
+		props[k] = v
+	}
+
+	m.created++
+	m.datasets[name] = &memoryDataset{Dataset{Name: name, Origin: origin, Type: datasetType}, props, m.created}
+}
+
+// Look up a property, following the inheritance from the parents like ZFS does.
+func (m *MemoryStorage) property(name string, property string) string {
+	d, ok := m.datasets[name]
+	if ok == false {
+		return "-"
+	}
+
+	if value, ok := d.properties[property]; ok {
+		return value
+	}
+
+	parent := parentDatasetName(name)
+	switch {
+	case property == "mountpoint" && d.dataset.Type == gozfs.DatasetSnapshot:
+		return "-"
+	case property == "mountpoint" && parent != "":
+		return strings.TrimSuffix(m.property(parent, property), "/") + "/" + strings.TrimPrefix(name, parent+"/")
+	case parent != "":
+		return m.property(parent, property)
+	case property == "compression":
+		return "off"
+	}
+	return "-"
+}
+
+// A copy of the dataset with its inherited properties filled in.
+func (m *MemoryStorage) get(name string) (*Dataset, error) {
+	d, ok := m.datasets[name]
+	if ok == false {
+		return nil, fmt.Errorf("cannot open '%s': dataset does not exist", name)
+	}
+
+	dataset := d.dataset
+	dataset.Mountpoint = m.property(name, "mountpoint")
+	dataset.Compression = m.property(name, "compression")
+	return &dataset, nil
+}
+
+// The names of every dataset and snapshot below the dataset, sorted.
+func (m *MemoryStorage) descendants(name string) []string {
+	var names []string
+	for n := range m.datasets {
+		if strings.HasPrefix(n, name+"/") || strings.HasPrefix(n, name+"@") {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The clones of the snapshot.
+func (m *MemoryStorage) clones(snapshot string) []string {
+	var names []string
+	for n := range m.datasets {
+		if m.datasets[n].dataset.Origin == snapshot {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *MemoryStorage) checkNewFilesystem(name string) error {
+	if _, ok := m.datasets[name]; ok {
+		return fmt.Errorf("cannot create '%s': dataset already exists", name)
+	}
+
+	parent := parentDatasetName(name)
+	if parent == "" || strings.Contains(name, "@") {
+		return fmt.Errorf("cannot create '%s': missing dataset name", name)
+	}
+
+	p, ok := m.datasets[parent]
+	if ok == false || p.dataset.Type != gozfs.DatasetFilesystem {
+		return fmt.Errorf("cannot create '%s': parent does not exist", name)
+	}
+	return nil
+}
+
+func (m *MemoryStorage) Datasets() ([]*Dataset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var names []string
+	for n := range m.datasets {
+		if m.datasets[n].dataset.Type == gozfs.DatasetFilesystem {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	datasets := []*Dataset{}
+	for n := range names {
+		d, _ := m.get(names[n])
+		datasets = append(datasets, d)
+	}
+	return datasets, nil
+}
+
+func (m *MemoryStorage) GetDataset(name string) (*Dataset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.get(name)
+}
+
+func (m *MemoryStorage) CreateFilesystem(name string, properties map[string]string) (*Dataset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err := m.checkNewFilesystem(name)
+	if err != nil {
+		return nil, err
+	}
+
+	m.add(name, gozfs.DatasetFilesystem, "", properties)
+	return m.get(name)
+}
+
+func (m *MemoryStorage) Snapshot(dataset string, name string) (*Dataset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := dataset + "@" + name
+	d, ok := m.datasets[dataset]
+	if ok == false || d.dataset.Type != gozfs.DatasetFilesystem {
+		return nil, fmt.Errorf("cannot open '%s': dataset does not exist", dataset)
+	}
+	if _, ok := m.datasets[snapshot]; ok {
+		return nil, fmt.Errorf("cannot create snapshot '%s': dataset already exists", snapshot)
+	}
+
+	m.add(snapshot, gozfs.DatasetSnapshot, "", nil)
+	return m.get(snapshot)
+}
+
+func (m *MemoryStorage) Snapshots(dataset string) ([]*Dataset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.datasets[dataset]; ok == false {
+		return nil, fmt.Errorf("cannot open '%s': dataset does not exist", dataset)
+	}
+
+	var names []string
+	for _, n := range append(m.descendants(dataset), dataset) {
+		if m.datasets[n].dataset.Type == gozfs.DatasetSnapshot {
+			names = append(names, n)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return m.datasets[names[i]].created < m.datasets[names[j]].created
+	})
+
+	snapshots := []*Dataset{}
+	for n := range names {
+		s, _ := m.get(names[n])
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, nil
+}
+
+func (m *MemoryStorage) Clone(snapshot string, destination string, properties map[string]string) (*Dataset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.datasets[snapshot]
+	if ok == false {
+		return nil, fmt.Errorf("cannot open '%s': dataset does not exist", snapshot)
+	}
+	if s.dataset.Type != gozfs.DatasetSnapshot {
+		return nil, fmt.Errorf("can only clone snapshots")
+	}
+
+	err := m.checkNewFilesystem(destination)
+	if err != nil {
+		return nil, err
+	}
+
+	m.add(destination, gozfs.DatasetFilesystem, snapshot, properties)
+	return m.get(destination)
+}
+
+func (m *MemoryStorage) Rollback(snapshot string, destroyMoreRecent bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.datasets[snapshot]
+	if ok == false {
+		return fmt.Errorf("cannot open '%s': dataset does not exist", snapshot)
+	}
+	if s.dataset.Type != gozfs.DatasetSnapshot {
+		return fmt.Errorf("can only rollback snapshots")
+	}
+
+	dataset := parentDatasetName(snapshot)
+	var newer []string
+	for n := range m.datasets {
+		d := m.datasets[n]
+		if d.dataset.Type == gozfs.DatasetSnapshot && parentDatasetName(n) == dataset && d.created > s.created {
+			newer = append(newer, n)
+		}
+	}
+	sort.Strings(newer)
+
+	if len(newer) > 0 && destroyMoreRecent == false {
+		return fmt.Errorf("cannot rollback to '%s': more recent snapshots or bookmarks exist", snapshot)
+	}
+
+	for n := range newer {
+		if clones := m.clones(newer[n]); len(clones) > 0 {
+			return fmt.Errorf("cannot rollback to '%s': clones of previous snapshots exist: %s", snapshot, strings.Join(clones, ", "))
+		}
+	}
+
+	for n := range newer {
+		delete(m.datasets, newer[n])
+	}
+	return nil
+}
+
+func (m *MemoryStorage) Destroy(name string, recursive bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.datasets[name]; ok == false {
+		return fmt.Errorf("cannot open '%s': dataset does not exist", name)
+	}
+
+	targets := m.descendants(name)
+	if len(targets) > 0 && recursive == false {
+		return fmt.Errorf("cannot destroy '%s': filesystem has children", name)
+	}
+	targets = append(targets, name)
+
+	destroying := make(map[string]bool)
+	for t := range targets {
+		destroying[targets[t]] = true
+	}
+
+	// Clones have to be destroyed before the snapshots they were cloned from.
+	for t := range targets {
+		for _, c := range m.clones(targets[t]) {
+			if destroying[c] == false {
+				return fmt.Errorf("cannot destroy '%s': snapshot has dependent clones: %s", targets[t], c)
+			}
+		}
+	}
+
+	for t := range targets {
+		delete(m.datasets, targets[t])
+	}
+	return nil
+}
+
+func (m *MemoryStorage) GetProperty(name string, property string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.datasets[name]; ok == false {
+		return "", fmt.Errorf("cannot open '%s': dataset does not exist", name)
+	}
+	return m.property(name, property), nil
+}
+
+func (m *MemoryStorage) SetProperty(name string, property string, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.datasets[name]
+	if ok == false {
+		return fmt.Errorf("cannot open '%s': dataset does not exist", name)
+	}
+
+	d.properties[property] = value
+	return nil
+}
+
+func (m *MemoryStorage) InheritProperty(name string, property string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.datasets[name]
+	if ok == false {
+		return fmt.Errorf("cannot open '%s': dataset does not exist", name)
+	}
+
+	delete(d.properties, property)
+	return nil
+}